@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	lib "github.com/justmiles/go-markdown2confluence/lib"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffWords    bool
+	diffExitCode bool
+)
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffWords, "words", false, "Show a word diff of the page text instead of a diff of the storage format")
+	diffCmd.Flags().BoolVar(&diffExitCode, "exit-code", false, "Exit with status 1 if any page would change")
+	rootCmd.AddCommand(diffCmd)
+}
+
+// diffCmd shows what publishing markdown files would change
+var diffCmd = &cobra.Command{
+	Use:   "diff [markdown files or directories]",
+	Short: "Show what publishing markdown files would change on their pages",
+	Run: func(diffCmd *cobra.Command, args []string) {
+		prepare(diffCmd, args, lib.Markdown2Confluence.Validate)
+
+		// standard output is reserved for the diff, like for the JSON report
+		changed, errors := m.Diff(diffWords)
+		for _, err := range errors {
+			fmt.Fprintln(os.Stderr)
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if len(errors) > 0 || (diffExitCode && changed) {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	lib "github.com/justmiles/go-markdown2confluence/lib"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+}
+
+// lintCmd checks markdown files for problems before publishing them
+var lintCmd = &cobra.Command{
+	Use:   "lint [markdown files or directories]",
+	Short: "Check markdown files for missing images, broken links, invalid titles and malformed macros",
+	Long: `Check markdown files for missing images, broken links, invalid titles and malformed macros.
+
+Duplicate titles are found among the files and folders being linted. With --endpoint
+and credentials, lint also looks up their titles in the space and reports pages
+outside of the published tree that publishing would collide with.`,
+	Run: func(lintCmd *cobra.Command, args []string) {
+		prepare(lintCmd, args, lib.Markdown2Confluence.ValidateRender)
+
+		problems, err := m.Lint()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
+			fmt.Printf("\n%d problems found\n", len(problems))
+			os.Exit(1)
+		}
+	},
+}
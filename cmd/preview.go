@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	lib "github.com/justmiles/go-markdown2confluence/lib"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	previewAddress  string
+	previewInterval time.Duration
+)
+
+func init() {
+	previewCmd.Flags().StringVar(&previewAddress, "listen", lib.DefaultPreviewAddress, "Address to serve the preview on")
+	previewCmd.Flags().DurationVar(&previewInterval, "interval", lib.DefaultWatchInterval, "How often to check the sources for changes")
+	rootCmd.AddCommand(previewCmd)
+}
+
+// previewCmd serves the rendered markdown files over HTTP
+var previewCmd = &cobra.Command{
+	Use:   "preview [markdown files or directories]",
+	Short: "Serve a local preview of the pages, reloading when the markdown files change",
+	Run: func(previewCmd *cobra.Command, args []string) {
+		prepare(previewCmd, args, lib.Markdown2Confluence.ValidateRender)
+
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+
+		if err := m.Preview(previewAddress, previewInterval, stop); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
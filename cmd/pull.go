@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	lib "github.com/justmiles/go-markdown2confluence/lib"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(pullCmd)
+}
+
+// pullCmd exports Confluence pages to markdown files
+var pullCmd = &cobra.Command{
+	Use:   "pull [output directory]",
+	Short: "Download the pages below --parent, or the whole space, as markdown files",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(pullCmd *cobra.Command, args []string) {
+		prepare(pullCmd, nil, lib.Markdown2Confluence.ValidatePull)
+
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+
+		errors := m.Pull(dir)
+		for _, err := range errors {
+			fmt.Println()
+			fmt.Println(err)
+		}
+		if len(errors) > 0 {
+			os.Exit(1)
+		}
+	},
+}
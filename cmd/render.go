@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	lib "github.com/justmiles/go-markdown2confluence/lib"
+
+	"github.com/spf13/cobra"
+)
+
+var renderOutputDir string
+
+func init() {
+	renderCmd.Flags().StringVarP(&renderOutputDir, "output-dir", "o", "rendered", "Directory to write the rendered pages and manifest to, or - for stdout")
+	rootCmd.AddCommand(renderCmd)
+}
+
+// renderCmd writes the storage format of markdown files without uploading them
+var renderCmd = &cobra.Command{
+	Use:   "render [markdown files or directories]",
+	Short: "Render markdown files to Confluence storage format without uploading them",
+	Run: func(renderCmd *cobra.Command, args []string) {
+		prepare(renderCmd, args, lib.Markdown2Confluence.ValidateRender)
+
+		errors := m.Render(renderOutputDir)
+		for _, err := range errors {
+			fmt.Println()
+			fmt.Println(err)
+		}
+		if len(errors) > 0 {
+			os.Exit(1)
+		}
+	},
+}
@@ -1,10 +1,9 @@
 package cmd
 
 import (
-	"crypto/tls"
 	"fmt"
+	"io"
 	"log"
-	"net/http"
 	"os"
 
 	lib "github.com/justmiles/go-markdown2confluence/lib"
@@ -12,7 +11,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var m lib.Markdown2Confluence
+var (
+	m          lib.Markdown2Confluence
+	configFile string
+	mappings   []string
+)
 
 func init() {
 	log.SetFlags(0)
@@ -20,6 +23,9 @@ func init() {
 	rootCmd.Flags().SetInterspersed(false)
 	rootCmd.PersistentFlags().StringVarP(&m.Space, "space", "s", "", "Space in which page should be created")
 	rootCmd.PersistentFlags().StringVarP(&m.Comment, "comment", "c", "", "(Optional) Add comment to page")
+	rootCmd.PersistentFlags().BoolVar(&m.GitComment, "git-comment", false, "Use the last git commit touching the file as version comment")
+	rootCmd.PersistentFlags().BoolVar(&m.GitFooter, "git-footer", false, "Append a footer with the author, date and commit of the last change to every page")
+	rootCmd.PersistentFlags().StringVar(&m.RepoURLTemplate, "repo-url", "", "Template for the footer link to the source file, e.g. https://github.com/org/repo/blob/{{.Hash}}/{{.Path}}")
 	rootCmd.PersistentFlags().StringVarP(&m.Username, "username", "u", "", "Confluence username. (Alternatively set CONFLUENCE_USERNAME environment variable)")
 	rootCmd.PersistentFlags().StringVarP(&m.Password, "password", "p", "", "Confluence password. (Alternatively set CONFLUENCE_PASSWORD environment variable)")
 	rootCmd.PersistentFlags().StringVarP(&m.AccessToken, "access-token", "a", "", "Confluence access-token. (Alternatively set CONFLUENCE_ACCESS_TOKEN environment variable)")
@@ -30,8 +36,34 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&m.UseDocumentTitle, "use-document-title", "", false, "Will use the Markdown document title (# Title) if available")
 	rootCmd.PersistentFlags().BoolVarP(&m.WithHardWraps, "hardwraps", "w", false, "Render newlines as <br />")
 	rootCmd.PersistentFlags().IntVarP(&m.Since, "modified-since", "m", 0, "Only upload files that have modifed in the past n minutes")
-	rootCmd.PersistentFlags().StringVarP(&m.Title, "title", "t", "", "Set the page title on upload (defaults to filename without extension)")
+	rootCmd.PersistentFlags().StringVar(&m.ChangedSince, "changed-since", "", "Only upload files that changed between the git ref and HEAD, or link to files that did")
+	rootCmd.PersistentFlags().StringVarP(&m.Title, "title", "t", "", "Set the page title on upload (defaults to filename without extension, required when reading from stdin)")
 	rootCmd.PersistentFlags().StringSliceVarP(&m.ExcludeFilePatterns, "exclude", "x", []string{}, "list of exclude file patterns (regex) for that will be applied on markdown file paths")
+	rootCmd.PersistentFlags().StringSliceVar(&m.ExcludePatterns, "exclude-glob", []string{}, "list of gitignore style glob patterns of files and directories to skip, relative to the source directory")
+	rootCmd.PersistentFlags().StringSliceVar(&m.IncludePatterns, "include", []string{}, "list of gitignore style glob patterns, only matching markdown files are published")
+	rootCmd.PersistentFlags().StringSliceVar(&m.Extensions, "extensions", lib.DefaultExtensions, "File extensions of the markdown files in source directories, JSX is stripped from .mdx files")
+	rootCmd.PersistentFlags().StringVar(&m.FolderTemplate, "folder-template", "", "Markdown template (Go text/template) for folder pages without a README.md or index.md")
+	rootCmd.PersistentFlags().StringVar(&m.FolderSort, "folder-sort", "title", "Sort order of the children macro on default folder pages (title, creation or modified)")
+	rootCmd.PersistentFlags().IntVar(&m.FolderDepth, "folder-depth", 0, "Depth of the children macro on default folder pages (0 shows all descendants)")
+	rootCmd.PersistentFlags().IntVar(&m.Parallelism, "parallelism", lib.DefaultParallelism, "Number of files to convert and upload at a time")
+	rootCmd.PersistentFlags().IntVar(&m.RetryAttempts, "retry-attempts", lib.DefaultRetryAttempts, "Number of attempts for Confluence API calls that were rate limited or failed temporarily")
+	rootCmd.PersistentFlags().DurationVar(&m.RetryMaxWait, "retry-max-wait", lib.DefaultRetryMaxWait, "Maximum time to wait between two attempts")
+	rootCmd.PersistentFlags().StringVar(&m.StateFile, "state-file", "", "File recording the page versions published by previous runs, used to detect edits made in Confluence")
+	rootCmd.PersistentFlags().StringVar(&m.OnConflict, "on-conflict", lib.ConflictFail, "What to do with pages edited in Confluence since they were last published, detected with --state-file (fail, warn or overwrite)")
+	rootCmd.PersistentFlags().StringVar(&m.TitleTemplate, "title-template", "", "Go template for page titles, with .Name, .Path, .Parents, .FrontMatter, .Heading and .Title")
+	rootCmd.PersistentFlags().BoolVar(&m.HumanizeTitles, "humanize-titles", false, "Strip numeric prefixes from file and folder names and convert kebab and snake case to title case")
+	rootCmd.PersistentFlags().StringVar(&m.TitlePrefix, "title-prefix", "", "Prefix for all page titles")
+	rootCmd.PersistentFlags().StringVar(&m.TitleSuffix, "title-suffix", "", "Suffix for all page titles")
+	rootCmd.PersistentFlags().StringVar(&m.TitleStrategy, "title-strategy", lib.TitleStrategyFail, "How to handle pages with the same title in a space: fail, or prefix the title with its parent or its path")
+	rootCmd.PersistentFlags().BoolVar(&m.OrderPages, "order-pages", false, "Reposition sibling pages after publishing, ordered by "+lib.OrderFileName+" files, weight or position front matter and numeric name prefixes")
+	rootCmd.PersistentFlags().BoolVar(&m.Nav, "nav", false, "Build the page hierarchy, titles and order from the SUMMARY.md or mkdocs.yml of every source instead of its directory structure")
+	rootCmd.PersistentFlags().StringSliceVar(&m.GoldmarkExtensions, "goldmark-extension", []string{}, "Enable a goldmark extension when rendering markdown: footnote, typographer, cjk, attribute or one registered by the program embedding the library (can be repeated)")
+	rootCmd.PersistentFlags().StringVar(&m.Output, "output", lib.OutputText, "Format of the publish report printed to stdout (text or json)")
+	rootCmd.PersistentFlags().StringVar(&m.ReportFile, "report-file", "", "Write a JSON report of the published files to this file")
+	rootCmd.PersistentFlags().StringVar(&m.JUnitFile, "junit", "", "Write a JUnit XML report with a test case per published file to this file")
+	rootCmd.PersistentFlags().StringSliceVarP(&m.Labels, "labels", "l", []string{}, "list of labels to add to every page")
+	rootCmd.PersistentFlags().StringArrayVar(&mappings, "map", []string{}, "Publish a source into its own space and parent, as source=SPACE[/parent] (can be repeated)")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file (defaults to "+lib.ConfigFileName+" in the source directory or any of its parents)")
 	m.SourceEnvironmentVariables()
 
 }
@@ -40,22 +72,15 @@ func init() {
 var rootCmd = &cobra.Command{
 	Use:   "markdown2confluence",
 	Short: "Push markdown files to Confluence Cloud",
+	Args:  cobra.ArbitraryArgs,
 	Run: func(rootCmd *cobra.Command, args []string) {
-		m.SourceMarkdown = args
-		// Validate the arguments
-		err := m.Validate()
-		if err != nil {
-			log.Fatal(err)
-		}
-		if m.InsecureTLS {
-			fmt.Println("Warning: TLS verification is disabled. This allows for man-in-the-middle-attacks.")
-			http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-		}
+		prepare(rootCmd, args, lib.Markdown2Confluence.Validate)
 
 		errors := m.Run()
+		out := messages()
 		for _, err := range errors {
-			fmt.Println()
-			fmt.Println(err)
+			fmt.Fprintln(out)
+			fmt.Fprintln(out, err)
 		}
 		if len(errors) > 0 {
 			os.Exit(1)
@@ -63,6 +88,71 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// messages returns where to print messages and errors. It is standard error
+// if standard output is reserved for the JSON report, as the errors are part
+// of the report.
+func messages() io.Writer {
+	if m.Output == lib.OutputJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// fatal exits with err, writing it as JSON report if that is the output
+func fatal(err error) {
+	if m.Output == lib.OutputJSON {
+		m.ReportError(err)
+	}
+	log.Fatal(err)
+}
+
+// prepare applies the arguments, mappings and config file and validates the
+// result. It exits on invalid settings.
+func prepare(cmd *cobra.Command, args []string, validate func(lib.Markdown2Confluence) error) {
+	m.SourceMarkdown = args
+	for _, s := range mappings {
+		mapping, err := lib.ParseSourceMapping(s)
+		if err != nil {
+			fatal(err)
+		}
+		m.Mappings = append(m.Mappings, mapping)
+	}
+	if err := loadConfig(cmd); err != nil {
+		fatal(err)
+	}
+	// Validate the arguments
+	err := validate(m)
+	if err != nil {
+		fatal(err)
+	}
+	if m.InsecureTLS {
+		fmt.Fprintln(messages(), "Warning: TLS verification is disabled. This allows for man-in-the-middle-attacks.")
+	}
+}
+
+// loadConfig applies the config file, unless a flag or environment variable
+// overrides its settings
+func loadConfig(cmd *cobra.Command) (err error) {
+	p := configFile
+	if p == "" {
+		start := "."
+		if len(m.SourceMarkdown) > 0 {
+			start = m.SourceMarkdown[0]
+		}
+		p, err = lib.FindConfig(start)
+		if err != nil || p == "" {
+			return err
+		}
+	}
+
+	c, err := lib.LoadConfig(p)
+	if err != nil {
+		return err
+	}
+	m.ApplyConfig(c, cmd.Flags().Changed)
+	return nil
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute(version string) {
@@ -70,7 +160,7 @@ func Execute(version string) {
 	rootCmd.SetVersionTemplate(`{{with .Name}}{{printf "%s " .}}{{end}}{{printf "%s" .Version}}
 `)
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(messages(), err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	lib "github.com/justmiles/go-markdown2confluence/lib"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchInterval time.Duration
+	watchDebounce time.Duration
+)
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", lib.DefaultWatchInterval, "How often to check the sources for changes")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", lib.DefaultWatchDebounce, "How long the sources have to be unchanged before publishing")
+	rootCmd.AddCommand(watchCmd)
+}
+
+// watchCmd republishes markdown files whenever they change
+var watchCmd = &cobra.Command{
+	Use:   "watch [markdown files or directories]",
+	Short: "Republish markdown files when they change",
+	Run: func(watchCmd *cobra.Command, args []string) {
+		prepare(watchCmd, args, lib.Markdown2Confluence.Validate)
+
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+
+		fmt.Fprintf(messages(), "Watching %v for changes. Press Ctrl+C to stop.\n", append(m.SourceMarkdown, mappingSources()...))
+		if err := m.Watch(watchInterval, watchDebounce, stop); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func mappingSources() (sources []string) {
+	for _, mapping := range m.Mappings {
+		sources = append(sources, mapping.Source)
+	}
+	return sources
+}
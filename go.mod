@@ -6,6 +6,7 @@ require (
 	github.com/justmiles/go-confluence v0.2.0
 	github.com/spf13/cobra v1.6.1
 	github.com/yuin/goldmark v1.5.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,29 @@
+package lib
+
+import (
+	"io"
+
+	"github.com/justmiles/go-confluence"
+)
+
+// Client is the part of the Confluence API used to publish, order and pull
+// pages. It is implemented by *ConfluenceClient and can be replaced to
+// publish through another client, or to publish into a fake in tests.
+type Client interface {
+	// GetContent returns the content matching the query, all of it if the
+	// query has no Limit
+	GetContent(qp *confluence.GetContentQueryParameters) ([]confluence.Content, error)
+	CreateContent(bp *confluence.CreateContentBodyParameters, qp *confluence.QueryParameters) (confluence.Content, error)
+	UpdateContent(content *confluence.Content, qp *confluence.QueryParameters) (confluence.Content, error)
+	AddLabels(contentID string, labels []string, prefix confluence.LabelPrefix) error
+	AddUpdateAttachments(contentID string, files []string) ([]*confluence.Attachment, []error)
+	FetchAttachmentMetaData(contentID string) (*confluence.AttachmentResults, error)
+	// DownloadAttachment writes the attachment at the download link, relative
+	// to the endpoint, to w
+	DownloadAttachment(link string, w io.Writer) error
+	// ChildPages returns the child pages of a page in their current order
+	ChildPages(contentID string) ([]confluence.Content, error)
+	// MovePage moves a page before or after a sibling, or appends it to the
+	// children of target
+	MovePage(contentID, position, targetID string) error
+}
@@ -0,0 +1,294 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the name of the project configuration file, discovered
+// from the source directory upward
+const ConfigFileName = ".markdown2confluence.yaml"
+
+// environmentVariables maps configuration keys to the environment variables
+// read by SourceEnvironmentVariables
+var environmentVariables = map[string]string{
+	"username":     "CONFLUENCE_USERNAME",
+	"password":     "CONFLUENCE_PASSWORD",
+	"access-token": "CONFLUENCE_ACCESS_TOKEN",
+	"endpoint":     "CONFLUENCE_ENDPOINT",
+}
+
+// Config is the content of a project configuration file. Its keys match the
+// command line flags. Directories holds overrides of the page settings for
+// the files below a directory, relative to the directory of the config file.
+type Config struct {
+	Space            *string  `yaml:"space"`
+	Parent           *string  `yaml:"parent"`
+	Comment          *string  `yaml:"comment"`
+	Labels           []string `yaml:"labels"`
+	Exclude          []string `yaml:"exclude"`
+	ExcludeGlob      []string `yaml:"exclude-glob"`
+	WithHardWraps    *bool    `yaml:"hardwraps"`
+	UseDocumentTitle *bool    `yaml:"use-document-title"`
+
+	Sources         []string        `yaml:"sources"`
+	Include         []string        `yaml:"include"`
+	Extensions      []string        `yaml:"extensions"`
+	Mappings        []SourceMapping `yaml:"mappings"`
+	Title           *string         `yaml:"title"`
+	Endpoint        *string         `yaml:"endpoint"`
+	Username        *string         `yaml:"username"`
+	Password        *string         `yaml:"password"`
+	AccessToken     *string         `yaml:"access-token"`
+	InsecureTLS     *bool           `yaml:"insecuretls"`
+	Debug           *bool           `yaml:"debug"`
+	Since           *int            `yaml:"modified-since"`
+	ChangedSince    *string         `yaml:"changed-since"`
+	FolderTemplate  *string         `yaml:"folder-template"`
+	FolderSort      *string         `yaml:"folder-sort"`
+	FolderDepth     *int            `yaml:"folder-depth"`
+	Parallelism     *int            `yaml:"parallelism"`
+	RetryAttempts   *int            `yaml:"retry-attempts"`
+	RetryMaxWait    *time.Duration  `yaml:"retry-max-wait"`
+	GitComment      *bool           `yaml:"git-comment"`
+	GitFooter       *bool           `yaml:"git-footer"`
+	RepoURLTemplate *string         `yaml:"repo-url"`
+	StateFile       *string         `yaml:"state-file"`
+	OnConflict      *string         `yaml:"on-conflict"`
+	TitleStrategy   *string         `yaml:"title-strategy"`
+	TitleTemplate   *string         `yaml:"title-template"`
+	HumanizeTitles  *bool           `yaml:"humanize-titles"`
+	TitlePrefix     *string         `yaml:"title-prefix"`
+	TitleSuffix     *string         `yaml:"title-suffix"`
+	OrderPages      *bool           `yaml:"order-pages"`
+	Output          *string         `yaml:"output"`
+	ReportFile      *string         `yaml:"report-file"`
+	JUnitFile       *string         `yaml:"junit"`
+	Goldmark        []string        `yaml:"goldmark-extensions"`
+	Nav             *bool           `yaml:"nav"`
+
+	Directories map[string]*Config `yaml:"directories"`
+
+	// dir is the directory of the config file, relative paths are resolved against it
+	dir string
+}
+
+// FindConfig searches for a config file in the directory of p and all of its
+// parents. It returns an empty string if there is none.
+func FindConfig(p string) (string, error) {
+	dir, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	if stat, err := os.Stat(dir); err == nil && !stat.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	for {
+		candidate := filepath.Join(dir, ConfigFileName)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig reads the config file at p
+func LoadConfig(p string) (*Config, error) {
+	dat, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open config file %s:\n\t%s", p, err)
+	}
+
+	var c Config
+	if err := yaml.Unmarshal(dat, &c); err != nil {
+		return nil, fmt.Errorf("Could not parse config file %s:\n\t%s", p, err)
+	}
+
+	c.dir, err = filepath.Abs(filepath.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ApplyConfig sets all settings of the config file that were neither passed
+// as flag nor as environment variable. changed reports whether the flag with
+// the given name was passed.
+func (m *Markdown2Confluence) ApplyConfig(c *Config, changed func(flag string) bool) {
+	m.config = c
+	m.configured = func(key string) bool {
+		if changed != nil && changed(key) {
+			return true
+		}
+		if env, ok := environmentVariables[key]; ok && os.Getenv(env) != "" {
+			return true
+		}
+		return false
+	}
+
+	m.applyPageConfig(c)
+
+	if len(m.SourceMarkdown) == 0 {
+		for _, source := range c.Sources {
+			m.SourceMarkdown = append(m.SourceMarkdown, c.path(source))
+		}
+	}
+	if c.Include != nil && !m.configured("include") {
+		m.IncludePatterns = append([]string{}, c.Include...)
+	}
+	if c.Extensions != nil && !m.configured("extensions") {
+		m.Extensions = append([]string{}, c.Extensions...)
+	}
+	if c.Goldmark != nil && !m.configured("goldmark-extension") {
+		m.GoldmarkExtensions = append([]string{}, c.Goldmark...)
+	}
+	if len(m.Mappings) == 0 && !m.configured("map") {
+		for _, mapping := range c.Mappings {
+			mapping.Source = c.path(mapping.Source)
+			m.Mappings = append(m.Mappings, mapping)
+		}
+	}
+	m.setString("title", &m.Title, c.Title)
+	m.setString("endpoint", &m.Endpoint, c.Endpoint)
+	m.setString("username", &m.Username, c.Username)
+	m.setString("password", &m.Password, c.Password)
+	m.setString("access-token", &m.AccessToken, c.AccessToken)
+	m.setBool("insecuretls", &m.InsecureTLS, c.InsecureTLS)
+	m.setBool("debug", &m.Debug, c.Debug)
+	m.setInt("modified-since", &m.Since, c.Since)
+	m.setString("changed-since", &m.ChangedSince, c.ChangedSince)
+	if c.FolderTemplate != nil {
+		template := c.path(*c.FolderTemplate)
+		m.setString("folder-template", &m.FolderTemplate, &template)
+	}
+	m.setString("folder-sort", &m.FolderSort, c.FolderSort)
+	m.setInt("folder-depth", &m.FolderDepth, c.FolderDepth)
+	m.setInt("parallelism", &m.Parallelism, c.Parallelism)
+	m.setInt("retry-attempts", &m.RetryAttempts, c.RetryAttempts)
+	if c.RetryMaxWait != nil && !m.configured("retry-max-wait") {
+		m.RetryMaxWait = *c.RetryMaxWait
+	}
+	m.setBool("git-comment", &m.GitComment, c.GitComment)
+	m.setBool("git-footer", &m.GitFooter, c.GitFooter)
+	m.setString("repo-url", &m.RepoURLTemplate, c.RepoURLTemplate)
+	if c.StateFile != nil {
+		stateFile := c.path(*c.StateFile)
+		m.setString("state-file", &m.StateFile, &stateFile)
+	}
+	m.setString("on-conflict", &m.OnConflict, c.OnConflict)
+	m.setString("title-strategy", &m.TitleStrategy, c.TitleStrategy)
+	m.setString("title-template", &m.TitleTemplate, c.TitleTemplate)
+	m.setBool("humanize-titles", &m.HumanizeTitles, c.HumanizeTitles)
+	m.setString("title-prefix", &m.TitlePrefix, c.TitlePrefix)
+	m.setString("title-suffix", &m.TitleSuffix, c.TitleSuffix)
+	m.setBool("order-pages", &m.OrderPages, c.OrderPages)
+	m.setString("output", &m.Output, c.Output)
+	if c.ReportFile != nil {
+		reportFile := c.path(*c.ReportFile)
+		m.setString("report-file", &m.ReportFile, &reportFile)
+	}
+	if c.JUnitFile != nil {
+		junitFile := c.path(*c.JUnitFile)
+		m.setString("junit", &m.JUnitFile, &junitFile)
+	}
+	m.setBool("nav", &m.Nav, c.Nav)
+}
+
+// applyPageConfig sets the settings that may be overridden per directory
+func (m *Markdown2Confluence) applyPageConfig(c *Config) {
+	m.setString("space", &m.Space, c.Space)
+	m.setString("parent", &m.Parent, c.Parent)
+	m.setString("comment", &m.Comment, c.Comment)
+	m.setBool("hardwraps", &m.WithHardWraps, c.WithHardWraps)
+	m.setBool("use-document-title", &m.UseDocumentTitle, c.UseDocumentTitle)
+	if c.Labels != nil && !m.configured("labels") {
+		m.Labels = append([]string{}, c.Labels...)
+	}
+	// exclude patterns accumulate across directories
+	if c.Exclude != nil && !m.configured("exclude") {
+		m.ExcludeFilePatterns = append(append([]string{}, m.ExcludeFilePatterns...), c.Exclude...)
+	}
+	if c.ExcludeGlob != nil && !m.configured("exclude-glob") {
+		m.ExcludePatterns = append(append([]string{}, m.ExcludePatterns...), c.ExcludeGlob...)
+	}
+}
+
+// settingsFor returns the settings applying to the markdown file at p, taking
+// the directory overrides of the config file into account
+func (m *Markdown2Confluence) settingsFor(p string) *Markdown2Confluence {
+	if m.config == nil || len(m.config.Directories) == 0 {
+		return m
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return m
+	}
+	rel, err := filepath.Rel(m.config.dir, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return m
+	}
+
+	settings := m
+	c := m.config
+	rel = filepath.ToSlash(rel)
+	for {
+		var next *Config
+		var nextDir string
+		// the most specific directory wins
+		for dir, override := range c.Directories {
+			dir = strings.Trim(filepath.ToSlash(dir), "/")
+			if strings.HasPrefix(rel, dir+"/") && len(dir) > len(nextDir) {
+				next, nextDir = override, dir
+			}
+		}
+		if next == nil {
+			return settings
+		}
+
+		if settings == m {
+			copied := *m
+			settings = &copied
+		}
+		settings.applyPageConfig(next)
+		c = next
+		rel = strings.TrimPrefix(rel, nextDir+"/")
+	}
+}
+
+// path resolves p relative to the directory of the config file
+func (c *Config) path(p string) string {
+	if filepath.IsAbs(p) || c.dir == "" {
+		return p
+	}
+	return filepath.Join(c.dir, p)
+}
+
+func (m *Markdown2Confluence) setString(key string, dst *string, src *string) {
+	if src != nil && !m.configured(key) {
+		*dst = *src
+	}
+}
+
+func (m *Markdown2Confluence) setBool(key string, dst *bool, src *bool) {
+	if src != nil && !m.configured(key) {
+		*dst = *src
+	}
+}
+
+func (m *Markdown2Confluence) setInt(key string, dst *int, src *int) {
+	if src != nil && !m.configured(key) {
+		*dst = *src
+	}
+}
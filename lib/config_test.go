@@ -0,0 +1,194 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfig = `
+space: DOCS
+username: config
+parent: Root
+labels: [docs]
+exclude-glob: ["*.tmp"]
+exclude: [".*generated.*"]
+parallelism: 4
+state-file: .state.json
+sources: [docs]
+directories:
+  docs/api:
+    space: API
+    labels: [api]
+    exclude-glob: ["*.draft.md"]
+    directories:
+      v2:
+        parent: Root/V2
+  docs/api/internal:
+    comment: internal
+`
+
+func writeTestConfig(t *testing.T) string {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "docs", "api", "v2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, ConfigFileName)
+	if err := ioutil.WriteFile(p, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFindConfig(t *testing.T) {
+	p := writeTestConfig(t)
+	dir := filepath.Dir(p)
+
+	for _, start := range []string{
+		dir,
+		filepath.Join(dir, "docs", "api", "v2"),
+		filepath.Join(dir, "docs", "api", "v2", "missing.md"),
+	} {
+		got, err := FindConfig(start)
+		if err != nil {
+			t.Errorf("FindConfig(%q): %s", start, err)
+			continue
+		}
+		if got != p {
+			t.Errorf("FindConfig(%q) = %q, want %q", start, got, p)
+		}
+	}
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	p := writeTestConfig(t)
+	c, err := LoadConfig(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(p)
+
+	tests := []struct {
+		name    string
+		flags   []string
+		env     map[string]string
+		initial Markdown2Confluence
+		check   func(m *Markdown2Confluence) bool
+	}{
+		{
+			"config applies",
+			nil, nil,
+			Markdown2Confluence{Space: "default", Parallelism: 1},
+			func(m *Markdown2Confluence) bool {
+				return m.Space == "DOCS" && m.Parent == "Root" && m.Parallelism == 4 && m.Username == "config" &&
+					reflect.DeepEqual(m.ExcludeFilePatterns, []string{".*generated.*"})
+			},
+		},
+		{
+			"flags win",
+			[]string{"space", "parallelism"}, nil,
+			Markdown2Confluence{Space: "FLAG", Parallelism: 2},
+			func(m *Markdown2Confluence) bool {
+				return m.Space == "FLAG" && m.Parallelism == 2 && m.Parent == "Root"
+			},
+		},
+		{
+			"environment wins",
+			nil, map[string]string{"CONFLUENCE_USERNAME": "env"},
+			Markdown2Confluence{Username: "env"},
+			func(m *Markdown2Confluence) bool { return m.Username == "env" },
+		},
+		{
+			"paths are relative to the config file",
+			nil, nil,
+			Markdown2Confluence{},
+			func(m *Markdown2Confluence) bool {
+				return m.StateFile == filepath.Join(dir, ".state.json") &&
+					reflect.DeepEqual(m.SourceMarkdown, []string{filepath.Join(dir, "docs")})
+			},
+		},
+		{
+			"sources on the command line win",
+			nil, nil,
+			Markdown2Confluence{SourceMarkdown: []string{"other"}},
+			func(m *Markdown2Confluence) bool {
+				return reflect.DeepEqual(m.SourceMarkdown, []string{"other"})
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, env := range environmentVariables {
+				t.Setenv(env, test.env[env])
+			}
+			m := test.initial
+			changed := func(flag string) bool {
+				for _, f := range test.flags {
+					if f == flag {
+						return true
+					}
+				}
+				return false
+			}
+			m.ApplyConfig(c, changed)
+			if !test.check(&m) {
+				t.Errorf("unexpected settings %+v", m)
+			}
+		})
+	}
+}
+
+func TestSettingsFor(t *testing.T) {
+	p := writeTestConfig(t)
+	c, err := LoadConfig(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(p)
+
+	tests := []struct {
+		path    string
+		flags   []string
+		space   string
+		parent  string
+		comment string
+		labels  []string
+		exclude []string
+	}{
+		{"README.md", nil, "DOCS", "Root", "", []string{"docs"}, []string{"*.tmp"}},
+		{"docs/guide.md", nil, "DOCS", "Root", "", []string{"docs"}, []string{"*.tmp"}},
+		{"docs/api/index.md", nil, "API", "Root", "", []string{"api"}, []string{"*.tmp", "*.draft.md"}},
+		{"docs/api/v2/index.md", nil, "API", "Root/V2", "", []string{"api"}, []string{"*.tmp", "*.draft.md"}},
+		{"docs/api/internal/a.md", nil, "DOCS", "Root", "internal", []string{"docs"}, []string{"*.tmp"}},
+		{"docs/apiary/a.md", nil, "DOCS", "Root", "", []string{"docs"}, []string{"*.tmp"}},
+		{"../outside.md", nil, "DOCS", "Root", "", []string{"docs"}, []string{"*.tmp"}},
+		{"docs/api/index.md", []string{"space"}, "FLAG", "Root", "", []string{"api"}, []string{"*.tmp", "*.draft.md"}},
+	}
+	for _, test := range tests {
+		m := &Markdown2Confluence{}
+		if test.flags != nil {
+			m.Space = "FLAG"
+		}
+		m.ApplyConfig(c, func(flag string) bool {
+			for _, f := range test.flags {
+				if f == flag {
+					return true
+				}
+			}
+			return false
+		})
+
+		s := m.settingsFor(filepath.Join(dir, filepath.FromSlash(test.path)))
+		if s.Space != test.space || s.Parent != test.parent || s.Comment != test.comment ||
+			!reflect.DeepEqual(s.Labels, test.labels) || !reflect.DeepEqual(s.ExcludePatterns, test.exclude) {
+			t.Errorf("settingsFor(%q) = space %q parent %q comment %q labels %v exclude %v, want %q %q %q %v %v",
+				test.path, s.Space, s.Parent, s.Comment, s.Labels, s.ExcludePatterns,
+				test.space, test.parent, test.comment, test.labels, test.exclude)
+		}
+		if !reflect.DeepEqual(m.Labels, []string{"docs"}) || !reflect.DeepEqual(m.ExcludePatterns, []string{"*.tmp"}) {
+			t.Errorf("settingsFor(%q) modified the base settings", test.path)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/justmiles/go-confluence"
+)
+
+// childPageLimit is the number of child pages fetched per request
+const childPageLimit = 100
+
+// ConfluenceClient is the Client for the Confluence REST API created by
+// CreateClient. Unlike confluence.Client it sends its requests through its
+// own http.Client and with the context of the run, so that retries and TLS
+// settings do not change other users of net/http in the process.
+type ConfluenceClient struct {
+	Endpoint    string
+	Username    string
+	Password    string
+	AccessToken string
+	// HTTPClient sends the requests. Defaults to http.DefaultClient
+	HTTPClient *http.Client
+	// Logger receives every request and its response status, if set
+	Logger Logger
+
+	ctx context.Context
+}
+
+var _ Client = (*ConfluenceClient)(nil)
+
+// WithContext returns a copy of the client that sends its requests with ctx
+func (c *ConfluenceClient) WithContext(ctx context.Context) *ConfluenceClient {
+	copied := *c
+	copied.ctx = ctx
+	return &copied
+}
+
+// request sends an authenticated request to the API path, or to an absolute
+// URL, and returns the response body
+func (c *ConfluenceClient) request(method, path string, query url.Values, body []byte, contentType string) ([]byte, error) {
+	u := path
+	if !strings.Contains(path, "://") {
+		u = c.Endpoint + path
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Atlassian-Token", "no-check")
+	if c.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+	} else {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if c.Logger != nil {
+		c.Logger.Printf("%s %s\n", method, u)
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	dat, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Logger != nil {
+		c.Logger.Printf("%s %s: %s\n", method, u, res.Status)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return dat, apiError(res, dat)
+	}
+	return dat, nil
+}
+
+// APIError is the error of a request Confluence rejected. Clients return it
+// so that version conflicts can be told apart from other failures.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// apiError returns the error of a failed API request
+func apiError(res *http.Response, dat []byte) error {
+	var apiResponse confluence.APIResponse
+	if err := json.Unmarshal(dat, &apiResponse); err == nil && apiResponse.Message != "" {
+		return &APIError{StatusCode: res.StatusCode, Message: apiResponse.Message}
+	}
+	return &APIError{StatusCode: res.StatusCode, Message: fmt.Sprintf("unexpected status %s", res.Status)}
+}
+
+// isConflict reports whether err is Confluence rejecting an update because
+// the page has a newer version
+func isConflict(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
+}
+
+// queryValues returns the query of the common query parameters
+func queryValues(qp *confluence.QueryParameters) url.Values {
+	query := url.Values{}
+	if qp == nil {
+		return query
+	}
+	if len(qp.Expand) > 0 {
+		query.Set("expand", strings.Join(qp.Expand, ","))
+	}
+	if qp.Status != "" {
+		query.Set("status", qp.Status)
+	}
+	return query
+}
+
+// pageLinks holds the link to the next page of a paginated response
+type pageLinks struct {
+	Links struct {
+		Next string `json:"next"`
+	} `json:"_links"`
+}
+
+// getPages requests the API path and the following pages of its results,
+// passing the body of every page to add. Confluence may return fewer results
+// than requested, e.g. for expanded bodies, so the next links are followed
+// instead of counting results.
+func (c *ConfluenceClient) getPages(path string, query url.Values, add func(dat []byte) error) error {
+	for path != "" {
+		dat, err := c.request(http.MethodGet, path, query, nil, "")
+		if err != nil {
+			return err
+		}
+		if err := add(dat); err != nil {
+			return err
+		}
+		var links pageLinks
+		if err := json.Unmarshal(dat, &links); err != nil {
+			return fmt.Errorf("invalid response: %s", err)
+		}
+		// next links carry the query of the following page
+		path, query = links.Links.Next, nil
+	}
+	return nil
+}
+
+// GetContent returns the content matching the query. Without a Limit all
+// matching content is returned.
+func (c *ConfluenceClient) GetContent(qp *confluence.GetContentQueryParameters) ([]confluence.Content, error) {
+	query := queryValues(&qp.QueryParameters)
+	if len(qp.Expand) > 0 {
+		query.Set("expand", strings.Join(qp.Expand, ","))
+	}
+	for key, value := range map[string]string{
+		"orderby":    qp.Orderby,
+		"postingDay": qp.PostingDay,
+		"spaceKey":   qp.Spacekey,
+		"title":      qp.Title,
+		"trigger":    qp.Trigger,
+		"type":       qp.Type,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if qp.Limit > 0 {
+		query.Set("limit", strconv.Itoa(qp.Limit))
+	}
+	if qp.Start > 0 {
+		query.Set("start", strconv.Itoa(qp.Start))
+	}
+
+	var contents []confluence.Content
+	add := func(dat []byte) error {
+		var page confluence.ContentResponse
+		if err := json.Unmarshal(dat, &page); err != nil {
+			return fmt.Errorf("invalid content response: %s", err)
+		}
+		contents = append(contents, page.Results...)
+		return nil
+	}
+	if qp.Limit > 0 {
+		dat, err := c.request(http.MethodGet, "/rest/api/content", query, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		return contents, add(dat)
+	}
+	if err := c.getPages("/rest/api/content", query, add); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// CreateContent creates a page
+func (c *ConfluenceClient) CreateContent(bp *confluence.CreateContentBodyParameters, qp *confluence.QueryParameters) (confluence.Content, error) {
+	var content confluence.Content
+	body, err := json.Marshal(bp)
+	if err != nil {
+		return content, err
+	}
+	dat, err := c.request(http.MethodPost, "/rest/api/content", queryValues(qp), body, "")
+	if err != nil {
+		return content, err
+	}
+	if err := json.Unmarshal(dat, &content); err != nil {
+		return content, fmt.Errorf("invalid content response: %s", err)
+	}
+	return content, nil
+}
+
+// UpdateContent writes a new version of a page
+func (c *ConfluenceClient) UpdateContent(content *confluence.Content, qp *confluence.QueryParameters) (confluence.Content, error) {
+	body, err := json.Marshal(content)
+	if err != nil {
+		return *content, err
+	}
+	dat, err := c.request(http.MethodPut, "/rest/api/content/"+content.ID, queryValues(qp), body, "")
+	if err != nil {
+		return *content, err
+	}
+	var updated confluence.Content
+	if err := json.Unmarshal(dat, &updated); err != nil {
+		return *content, fmt.Errorf("invalid content response: %s", err)
+	}
+	return updated, nil
+}
+
+// AddLabels adds labels to a page
+func (c *ConfluenceClient) AddLabels(contentID string, labels []string, prefix confluence.LabelPrefix) error {
+	type label struct {
+		Prefix string `json:"prefix"`
+		Name   string `json:"name"`
+	}
+	var body []label
+	for _, l := range labels {
+		body = append(body, label{Prefix: string(prefix), Name: l})
+	}
+	dat, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	_, err = c.request(http.MethodPost, "/rest/api/content/"+contentID+"/label", nil, dat, "")
+	return err
+}
+
+// AddUpdateAttachments uploads the files as attachments of a page, adding a
+// new version of attachments that already exist
+func (c *ConfluenceClient) AddUpdateAttachments(contentID string, files []string) ([]*confluence.Attachment, []error) {
+	var (
+		attachments []*confluence.Attachment
+		errors      []error
+	)
+	for _, f := range files {
+		attachment, err := c.uploadAttachment(contentID, f)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("Error uploading attachment %s: %s", f, err))
+			continue
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, errors
+}
+
+// uploadAttachment adds or updates the attachment named after the file p
+func (c *ConfluenceClient) uploadAttachment(contentID, p string) (*confluence.Attachment, error) {
+	endpoint := "/rest/api/content/" + contentID + "/child/attachment"
+	dat, err := c.request(http.MethodGet, endpoint, url.Values{"filename": {filepath.Base(p)}}, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	var existing confluence.Attachments
+	if err := json.Unmarshal(dat, &existing); err != nil {
+		return nil, fmt.Errorf("invalid attachment response: %s", err)
+	}
+	if len(existing.Results) > 0 {
+		endpoint += "/" + existing.Results[0].ID + "/data"
+	}
+
+	body, contentType, err := attachmentBody(p, len(existing.Results) > 0)
+	if err != nil {
+		return nil, err
+	}
+	dat, err = c.request(http.MethodPost, endpoint, nil, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	// new attachments are returned as list, new versions on their own
+	if len(existing.Results) > 0 {
+		var attachment confluence.Attachment
+		if err := json.Unmarshal(dat, &attachment); err != nil {
+			return nil, fmt.Errorf("invalid attachment response: %s", err)
+		}
+		return &attachment, nil
+	}
+	var created confluence.Attachments
+	if err := json.Unmarshal(dat, &created); err != nil {
+		return nil, fmt.Errorf("invalid attachment response: %s", err)
+	}
+	if len(created.Results) == 0 {
+		return nil, fmt.Errorf("empty attachment response")
+	}
+	return &created.Results[0], nil
+}
+
+// attachmentBody returns the multipart form uploading the file p with its
+// checksum as comment
+func attachmentBody(p string, minorEdit bool) ([]byte, string, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, err := writer.CreateFormFile("file", filepath.Base(p))
+	if err != nil {
+		return nil, "", err
+	}
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(part, hash), file); err != nil {
+		return nil, "", err
+	}
+	if minorEdit {
+		if err := writer.WriteField("minorEdit", "true"); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := writer.WriteField("comment", hex.EncodeToString(hash.Sum(nil))); err != nil {
+		return nil, "", err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), writer.FormDataContentType(), nil
+}
+
+// FetchAttachmentMetaData returns all attachments of a page
+func (c *ConfluenceClient) FetchAttachmentMetaData(contentID string) (*confluence.AttachmentResults, error) {
+	var attachments confluence.AttachmentResults
+	err := c.getPages("/rest/api/content/"+contentID+"/child/attachment", nil, func(dat []byte) error {
+		var page confluence.AttachmentResults
+		if err := json.Unmarshal(dat, &page); err != nil {
+			return fmt.Errorf("invalid attachment response: %s", err)
+		}
+		attachments.Results = append(attachments.Results, page.Results...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	attachments.Size = float64(len(attachments.Results))
+	return &attachments, nil
+}
+
+// DownloadAttachment writes the attachment at the download link to w
+func (c *ConfluenceClient) DownloadAttachment(link string, w io.Writer) error {
+	dat, err := c.request(http.MethodGet, link, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(dat)
+	return err
+}
+
+// ChildPages returns the child pages of a page in their current order
+func (c *ConfluenceClient) ChildPages(contentID string) ([]confluence.Content, error) {
+	var children []confluence.Content
+	query := url.Values{"limit": {strconv.Itoa(childPageLimit)}}
+	err := c.getPages("/rest/api/content/"+contentID+"/child/page", query, func(dat []byte) error {
+		var page confluence.ContentResponse
+		if err := json.Unmarshal(dat, &page); err != nil {
+			return fmt.Errorf("invalid child page response: %s", err)
+		}
+		children = append(children, page.Results...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching child pages: %s", err)
+	}
+	return children, nil
+}
+
+// MovePage moves a page before or after a sibling, or appends it to the
+// children of target, with the content move API
+func (c *ConfluenceClient) MovePage(contentID, position, targetID string) error {
+	_, err := c.request(http.MethodPut, "/rest/api/content/"+contentID+"/move/"+position+"/"+targetID, nil, nil, "")
+	return err
+}
@@ -0,0 +1,301 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/justmiles/go-confluence"
+)
+
+// apiRequest is a request received by the test server
+type apiRequest struct {
+	method string
+	path   string
+	query  string
+	body   string
+	header http.Header
+}
+
+// apiResponse is the canned answer of the test server to a request
+type apiResponse struct {
+	status int
+	body   string
+}
+
+// testAPI starts a server answering "METHOD /path" requests, with the query
+// after a ? if it matters, and records all requests
+func testAPI(t *testing.T, responses map[string]apiResponse) (*ConfluenceClient, *[]apiRequest) {
+	var requests []apiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dat, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, apiRequest{r.Method, r.URL.Path, r.URL.RawQuery, string(dat), r.Header})
+
+		res, ok := responses[r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery]
+		if !ok {
+			res, ok = responses[r.Method+" "+r.URL.Path]
+		}
+		if !ok {
+			res = apiResponse{http.StatusNotFound, `{"statusCode": 404, "message": "not found"}`}
+		}
+		if res.status == 0 {
+			res.status = http.StatusOK
+		}
+		w.WriteHeader(res.status)
+		w.Write([]byte(res.body))
+	}))
+	t.Cleanup(server.Close)
+	return &ConfluenceClient{Endpoint: server.URL, Username: "user", Password: "secret"}, &requests
+}
+
+func TestConfluenceClientContent(t *testing.T) {
+	client, requests := testAPI(t, map[string]apiResponse{
+		"GET /rest/api/content":          {body: `{"results": [{"id": "1", "title": "Home", "version": {"number": 3}}], "size": 1}`},
+		"POST /rest/api/content":         {body: `{"id": "2", "title": "New"}`},
+		"PUT /rest/api/content/1":        {body: `{"id": "1", "title": "Home", "version": {"number": 4}}`},
+		"PUT /rest/api/content/9":        {status: http.StatusConflict, body: `{"statusCode": 409, "message": "Version must be incremented on update. Current version is: 5"}`},
+		"POST /rest/api/content/1/label": {body: `{"results": []}`},
+	})
+
+	results, err := client.GetContent(&confluence.GetContentQueryParameters{
+		Title:           "Home",
+		Spacekey:        "DOCS",
+		Type:            "page",
+		Limit:           1,
+		QueryParameters: confluence.QueryParameters{Expand: []string{"version", "body.storage"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != "1" || results[0].Version.Number != 3 {
+		t.Errorf("GetContent = %+v", results)
+	}
+	if got, want := (*requests)[0].query, "expand=version%2Cbody.storage&limit=1&spaceKey=DOCS&title=Home&type=page"; got != want {
+		t.Errorf("GetContent query = %q, want %q", got, want)
+	}
+	if user, password, ok := (&http.Request{Header: (*requests)[0].header}).BasicAuth(); !ok || user != "user" || password != "secret" {
+		t.Errorf("GetContent was not authenticated")
+	}
+
+	created, err := client.CreateContent(&confluence.CreateContentBodyParameters{Content: confluence.Content{Title: "New", Type: "page"}}, nil)
+	if err != nil || created.ID != "2" {
+		t.Errorf("CreateContent = %+v, %v", created, err)
+	}
+	var sent confluence.Content
+	if err := json.Unmarshal([]byte((*requests)[1].body), &sent); err != nil || sent.Title != "New" {
+		t.Errorf("CreateContent sent %q", (*requests)[1].body)
+	}
+
+	content := confluence.Content{ID: "1", Title: "Home"}
+	content.Version.Number = 4
+	updated, err := client.UpdateContent(&content, nil)
+	if err != nil || updated.Version.Number != 4 {
+		t.Errorf("UpdateContent = %+v, %v", updated, err)
+	}
+
+	content.ID = "9"
+	_, err = client.UpdateContent(&content, nil)
+	if !isConflict(err) || err.Error() != "Version must be incremented on update. Current version is: 5" {
+		t.Errorf("UpdateContent of a stale version = %v, want a conflict", err)
+	}
+
+	if err := client.AddLabels("1", []string{"a", "b"}, confluence.LabelPrefix("global")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := (*requests)[4].body, `[{"prefix":"global","name":"a"},{"prefix":"global","name":"b"}]`; got != want {
+		t.Errorf("AddLabels sent %q, want %q", got, want)
+	}
+}
+
+func TestConfluenceClientErrors(t *testing.T) {
+	client, _ := testAPI(t, map[string]apiResponse{
+		"GET /rest/api/content/1/child/page": {status: http.StatusInternalServerError, body: "<html>oops</html>"},
+	})
+
+	tests := []struct {
+		name    string
+		call    func() error
+		status  int
+		message string
+	}{
+		{"api message", func() error { return client.MovePage("1", "after", "2") }, http.StatusNotFound, "not found"},
+		{"attachments of a missing page", func() error { _, err := client.FetchAttachmentMetaData("1"); return err }, http.StatusNotFound, "not found"},
+		{"unexpected body", func() error { return client.DownloadAttachment("/rest/api/content/1/child/page", ioutil.Discard) }, http.StatusInternalServerError, "unexpected status 500 Internal Server Error"},
+	}
+	for _, test := range tests {
+		err := test.call()
+		apiErr, ok := err.(*APIError)
+		if !ok {
+			t.Errorf("%s: error %v is not an APIError", test.name, err)
+			continue
+		}
+		if apiErr.StatusCode != test.status || apiErr.Message != test.message {
+			t.Errorf("%s: error = %d %q, want %d %q", test.name, apiErr.StatusCode, apiErr.Message, test.status, test.message)
+		}
+		if isConflict(err) {
+			t.Errorf("%s: %v is not a conflict", test.name, err)
+		}
+	}
+}
+
+func TestConfluenceClientAttachments(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"new.png": "new image", "old.png": "old image"}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client, requests := testAPI(t, map[string]apiResponse{
+		"GET /rest/api/content/1/child/attachment?filename=new.png": {body: `{"results": [], "size": 0}`},
+		"GET /rest/api/content/1/child/attachment?filename=old.png": {body: `{"results": [{"id": "att7", "title": "old.png"}], "size": 1}`},
+		"POST /rest/api/content/1/child/attachment":                 {body: `{"results": [{"id": "att8", "title": "new.png"}], "size": 1}`},
+		"POST /rest/api/content/1/child/attachment/att7/data":       {body: `{"id": "att7", "title": "old.png", "version": {"number": 2}}`},
+		"GET /rest/api/content/1/child/attachment":                  {body: `{"results": [{"id": "att7", "title": "old.png", "_links": {"download": "/download/attachments/1/old.png?version=2"}}], "size": 1}`},
+		"GET /download/attachments/1/old.png?version=2":             {body: "old image"},
+	})
+
+	attachments, errs := client.AddUpdateAttachments("1", []string{filepath.Join(dir, "new.png"), filepath.Join(dir, "old.png"), filepath.Join(dir, "missing.png")})
+	if len(attachments) != 2 || attachments[0].ID != "att8" || attachments[1].ID != "att7" || attachments[1].Version.Number != 2 {
+		t.Errorf("AddUpdateAttachments = %+v", attachments)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "missing.png") {
+		t.Errorf("AddUpdateAttachments errors = %v, want one for missing.png", errs)
+	}
+
+	var uploads []apiRequest
+	for _, req := range *requests {
+		if req.method == http.MethodPost {
+			uploads = append(uploads, req)
+		}
+	}
+	if len(uploads) != 2 {
+		t.Fatalf("got %d uploads, want 2", len(uploads))
+	}
+	for i, want := range []map[string]string{
+		{"file": "new image"},
+		{"file": "old image", "minorEdit": "true"},
+	} {
+		if uploads[i].header.Get("X-Atlassian-Token") != "no-check" {
+			t.Errorf("upload %d misses the X-Atlassian-Token header", i)
+		}
+		// the checksum of the file is the comment of the attachment
+		sum := md5.Sum([]byte(want["file"]))
+		want["comment"] = hex.EncodeToString(sum[:])
+		if fields := multipartFields(t, uploads[i]); !reflect.DeepEqual(fields, want) {
+			t.Errorf("upload %d sent %v, want %v", i, fields, want)
+		}
+	}
+
+	meta, err := client.FetchAttachmentMetaData("1")
+	if err != nil || len(meta.Results) != 1 || meta.Results[0].Links.Download != "/download/attachments/1/old.png?version=2" {
+		t.Fatalf("FetchAttachmentMetaData = %+v, %v", meta, err)
+	}
+	var buf bytes.Buffer
+	if err := client.DownloadAttachment(meta.Results[0].Links.Download, &buf); err != nil || buf.String() != "old image" {
+		t.Errorf("DownloadAttachment = %q, %v", buf.String(), err)
+	}
+}
+
+// multipartFields returns the fields of a multipart upload
+func multipartFields(t *testing.T, req apiRequest) map[string]string {
+	_, params, err := mime.ParseMediaType(req.header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := multipart.NewReader(strings.NewReader(req.body), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[string]string)
+	for name, values := range form.Value {
+		fields[name] = values[0]
+	}
+	for name, headers := range form.File {
+		f, err := headers[0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dat, _ := ioutil.ReadAll(f)
+		f.Close()
+		fields[name] = string(dat)
+	}
+	return fields
+}
+
+func TestConfluenceClientPagination(t *testing.T) {
+	// the server returns fewer results than requested and links the next page
+	client, requests := testAPI(t, map[string]apiResponse{
+		"GET /rest/api/content?spaceKey=DOCS":                  {body: `{"results": [{"id": "1"}, {"id": "2"}], "size": 2, "_links": {"next": "/rest/api/content?spaceKey=DOCS&start=2"}}`},
+		"GET /rest/api/content?spaceKey=DOCS&start=2":          {body: `{"results": [{"id": "3"}], "size": 1}`},
+		"GET /rest/api/content?limit=1&spaceKey=DOCS":          {body: `{"results": [{"id": "1"}], "size": 1, "_links": {"next": "/rest/api/content?limit=1&spaceKey=DOCS&start=1"}}`},
+		"GET /rest/api/content/1/child/page?limit=100":         {body: `{"results": [{"id": "4"}, {"id": "5"}], "size": 2, "_links": {"next": "/rest/api/content/1/child/page?limit=100&start=2"}}`},
+		"GET /rest/api/content/1/child/page?limit=100&start=2": {body: `{"results": [{"id": "6"}], "size": 1, "_links": {}}`},
+		"GET /rest/api/content/1/child/attachment":             {body: `{"results": [{"id": "att1"}], "size": 1, "_links": {"next": "/rest/api/content/1/child/attachment?start=1"}}`},
+		"GET /rest/api/content/1/child/attachment?start=1":     {body: `{"results": [{"id": "att2"}], "size": 1}`},
+		"PUT /rest/api/content/2/move/after/3":                 {body: `{"id": "2"}`},
+	})
+
+	ids := func(contents []confluence.Content) string {
+		var ids []string
+		for _, content := range contents {
+			ids = append(ids, content.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	all, err := client.GetContent(&confluence.GetContentQueryParameters{Spacekey: "DOCS"})
+	if err != nil || ids(all) != "1,2,3" {
+		t.Errorf("GetContent without limit = %s, %v, want 1,2,3", ids(all), err)
+	}
+	limited, err := client.GetContent(&confluence.GetContentQueryParameters{Spacekey: "DOCS", Limit: 1})
+	if err != nil || ids(limited) != "1" {
+		t.Errorf("GetContent with limit = %s, %v, want 1", ids(limited), err)
+	}
+
+	children, err := client.ChildPages("1")
+	if err != nil || ids(children) != "4,5,6" {
+		t.Errorf("ChildPages = %s, %v, want 4,5,6", ids(children), err)
+	}
+
+	attachments, err := client.FetchAttachmentMetaData("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments.Results) != 2 || attachments.Results[1].ID != "att2" || attachments.Size != 2 {
+		t.Errorf("FetchAttachmentMetaData = %+v, want att1 and att2", attachments)
+	}
+
+	if err := client.MovePage("2", "after", "3"); err != nil {
+		t.Fatal(err)
+	}
+	last := (*requests)[len(*requests)-1]
+	if last.method != http.MethodPut || last.path != "/rest/api/content/2/move/after/3" {
+		t.Errorf("MovePage sent %s %s", last.method, last.path)
+	}
+}
+
+func TestConfluenceClientAccessToken(t *testing.T) {
+	client, requests := testAPI(t, map[string]apiResponse{
+		"GET /rest/api/content": {body: `{"results": []}`},
+	})
+	client.AccessToken = "token"
+	if _, err := client.GetContent(&confluence.GetContentQueryParameters{}); err != nil {
+		t.Fatal(err)
+	}
+	header := (*requests)[0].header
+	if got := header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization = %q, want a bearer token", got)
+	}
+}
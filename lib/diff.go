@@ -0,0 +1,431 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/justmiles/go-confluence"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// normalizeStorage breaks storage format into one element per line so that
+// changes can be compared line by line
+func normalizeStorage(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "><", ">\n<")
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLines computes a line based edit script using the longest common
+// subsequence. Common leading and trailing lines are split off first and the
+// rest is compared with Hirschberg's algorithm, which needs linear space.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = hirschberg(ops, a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	// list removed lines before added lines within each change
+	for start := 0; start < len(ops); start++ {
+		end := start
+		for end < len(ops) && ops[end].kind != ' ' {
+			end++
+		}
+		sort.SliceStable(ops[start:end], func(i, j int) bool {
+			return ops[start+i].kind == '-' && ops[start+j].kind == '+'
+		})
+		start = end
+	}
+	return ops
+}
+
+// hirschberg appends the edit script from a to b to ops
+func hirschberg(ops []diffOp, a, b []string) []diffOp {
+	switch {
+	case len(a) == 0:
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	case len(b) == 0:
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		return ops
+	case len(a) == 1:
+		for j, line := range b {
+			if line == a[0] {
+				ops = hirschberg(ops, nil, b[:j])
+				ops = append(ops, diffOp{' ', line})
+				return hirschberg(ops, nil, b[j+1:])
+			}
+		}
+		ops = append(ops, diffOp{'-', a[0]})
+		return hirschberg(ops, nil, b)
+	}
+
+	// split b where the halves of a share the longest common subsequence
+	mid := len(a) / 2
+	forward := lcsLengths(a[:mid], b, false)
+	backward := lcsLengths(a[mid:], b, true)
+	split, best := 0, -1
+	for j := 0; j <= len(b); j++ {
+		if l := forward[j] + backward[len(b)-j]; l > best {
+			split, best = j, l
+		}
+	}
+	ops = hirschberg(ops, a[:mid], b[:split])
+	return hirschberg(ops, a[mid:], b[split:])
+}
+
+// lcsLengths returns the lengths of the longest common subsequences of a and
+// every prefix of b, or with reverse set of every suffix of b, indexed by the
+// length of the prefix or suffix
+func lcsLengths(a, b []string, reverse bool) []int {
+	at := func(s []string, i int) string {
+		if reverse {
+			return s[len(s)-1-i]
+		}
+		return s[i]
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if at(a, i) == at(b, j) {
+				cur[j+1] = prev[j] + 1
+			} else if prev[j+1] >= cur[j] {
+				cur[j+1] = prev[j+1]
+			} else {
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+// unifiedDiff returns a unified diff between a and b, or an empty string if
+// they are equal
+func unifiedDiff(fromName, toName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	// line numbers of the next op in a and b
+	aLine, bLine := 1, 1
+	for start := 0; start < len(ops); {
+		// find the next change
+		if ops[start].kind == ' ' {
+			start++
+			aLine++
+			bLine++
+			continue
+		}
+
+		// extend the hunk until there are more than 2*diffContext unchanged lines
+		end := start
+		for unchanged := 0; end < len(ops); end++ {
+			if ops[end].kind == ' ' {
+				unchanged++
+				if unchanged > 2*diffContext {
+					end -= unchanged - diffContext - 1
+					break
+				}
+			} else {
+				unchanged = 0
+			}
+		}
+		if end > len(ops) {
+			end = len(ops)
+		}
+		// trim trailing context
+		trailing := 0
+		for k := end - 1; k >= start && ops[k].kind == ' '; k-- {
+			trailing++
+		}
+		if trailing > diffContext {
+			end -= trailing - diffContext
+		}
+
+		// include leading context
+		from := start
+		for from > 0 && start-from < diffContext && ops[from-1].kind == ' ' {
+			from--
+		}
+
+		aStart, bStart := aLine-(start-from), bLine-(start-from)
+		var aCount, bCount int
+		var hunk strings.Builder
+		for _, op := range ops[from:end] {
+			hunk.WriteByte(op.kind)
+			hunk.WriteString(op.line)
+			hunk.WriteByte('\n')
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		// empty ranges refer to the line before the change
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		out.WriteString(hunk.String())
+
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+		start = end
+	}
+	return out.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// Diff prints what publishing the sources would change on their pages, as
+// unified diff of the normalized storage format or, with words set, as word
+// diff of the text. It reports whether any page would change.
+func (m *Markdown2Confluence) Diff(words bool) (bool, []error) {
+	if err := m.prepare(); err != nil {
+		return false, []error{err}
+	}
+
+	markdownFiles, err := m.discoverAll(time.Now())
+	if err != nil {
+		return false, []error{err}
+	}
+	if m.ChangedSince != "" {
+		markdownFiles, err = m.filterChanged(markdownFiles)
+		if err != nil {
+			return false, []error{err}
+		}
+	}
+
+	var changed bool
+	var errors []error
+	for _, markdownFile := range markdownFiles {
+		diff, err := markdownFile.diff(m, words)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("Unable to diff markdown file %s: \n\t%s", markdownFile.Path, err))
+			continue
+		}
+		if diff != "" {
+			changed = true
+			fmt.Fprint(m.stdout(), diff)
+		}
+	}
+	return changed, errors
+}
+
+// diff compares the rendered markdown file with the current body of its page
+func (f *MarkdownFile) diff(m *Markdown2Confluence, words bool) (string, error) {
+	settings := f.pageSettings(m)
+	wikiContent, _, _, err := f.render(m)
+	if err != nil {
+		return "", err
+	}
+
+	contentResults, err := f.publishedPage(m, settings.Space)
+	if err != nil {
+		return "", err
+	}
+
+	fromName, remote := "/dev/null", ""
+	if len(contentResults) > 0 {
+		fromName = fmt.Sprintf("%s/%s (version %d)", settings.Space, f.Title, contentResults[0].Version.Number)
+		remote = contentResults[0].Body.Storage.Value
+	}
+
+	if !words {
+		return unifiedDiff(fromName, f.Path, normalizeStorage(remote), normalizeStorage(wikiContent)), nil
+	}
+
+	remoteText, err := storageText(remote)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing page body: %s", err)
+	}
+	localText, err := storageText(wikiContent)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing rendered content: %s", err)
+	}
+	return wordDiff(fromName, f.Path, remoteText, localText), nil
+}
+
+// publishedPage returns the page the file would be published to. Like
+// publishing, it applies the title strategy to pages with its title outside of
+// the published tree. Pages below a parent that does not exist yet are new.
+func (f *MarkdownFile) publishedPage(m *Markdown2Confluence, space string) ([]confluence.Content, error) {
+	if parents := deleteEmpty(f.Parents); len(parents) > 0 && f.root == "" {
+		contentResults, err := m.Client.GetContent(&confluence.GetContentQueryParameters{
+			Title:    parents[0],
+			Spacekey: space,
+			Limit:    1,
+			Type:     "page",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Error checking for parent page: %s", err)
+		}
+		if len(contentResults) == 0 {
+			return nil, nil
+		}
+		f.root = contentResults[0].ID
+	}
+	return f.existingPage(m, space)
+}
+
+// storageText extracts the text of storage format, one block element per line
+func storageText(s string) (string, error) {
+	root, err := parseStorage(s)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	var walk func(n *storageNode)
+	walk = func(n *storageNode) {
+		switch n.name {
+		case "":
+			b.WriteString(n.text)
+			return
+		case "ac:parameter", "ac:task-id", "ac:task-status":
+			return
+		case "br", "th", "td":
+			b.WriteString(" ")
+		}
+		for _, c := range n.children {
+			walk(c)
+		}
+		if !isInline(n) && n.name != "th" && n.name != "td" {
+			b.WriteString("\n")
+		}
+	}
+	walk(root)
+
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line = strings.Join(strings.Fields(strings.ReplaceAll(line, "\u00a0", " ")), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// wordDiff returns the lines of b that changed compared to a, marking removed
+// words as [-word-] and added words as {+word+}. It returns an empty string if
+// a and b have the same words.
+func wordDiff(fromName, toName, a, b string) string {
+	ops := diffLines(splitWords(a), splitWords(b))
+	// text that only differs in whitespace has no changed words
+	changes := false
+	for _, op := range ops {
+		changes = changes || op.kind != ' '
+	}
+	if !changes {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	var line []string
+	lineNumber, changed := 1, false
+	flush := func() {
+		if changed {
+			fmt.Fprintf(&out, "@@ %d @@\n%s\n", lineNumber, strings.Join(line, " "))
+		}
+		line, changed = nil, false
+		lineNumber++
+	}
+
+	for i := 0; i < len(ops); {
+		op := ops[i]
+		if op.line == "\n" && op.kind != '-' {
+			flush()
+			i++
+			continue
+		}
+		if op.kind == ' ' {
+			line = append(line, op.line)
+			i++
+			continue
+		}
+
+		// group consecutive removed or added words, removed line breaks join lines
+		var run []string
+		for ; i < len(ops) && ops[i].kind == op.kind && (ops[i].line != "\n" || op.kind == '-'); i++ {
+			if ops[i].line != "\n" {
+				run = append(run, ops[i].line)
+			}
+		}
+		if len(run) > 0 {
+			if op.kind == '-' {
+				line = append(line, "[-"+strings.Join(run, " ")+"-]")
+			} else {
+				line = append(line, "{+"+strings.Join(run, " ")+"+}")
+			}
+		}
+		changed = true
+	}
+	flush()
+	return out.String()
+}
+
+// splitWords splits text into words and line breaks
+func splitWords(s string) []string {
+	var tokens []string
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			tokens = append(tokens, "\n")
+		}
+		tokens = append(tokens, strings.Fields(line)...)
+	}
+	return tokens
+}
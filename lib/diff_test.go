@@ -0,0 +1,137 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeStorage(t *testing.T) {
+	tests := []struct {
+		storage string
+		want    string
+	}{
+		{"", ""},
+		{"<p>a</p><p>b</p>", "<p>a</p>\n<p>b</p>"},
+		{"<p>a</p>\r\n\r\n  <p>b</p>  ", "<p>a</p>\n<p>b</p>"},
+		{"<ul><li>x</li></ul>", "<ul>\n<li>x</li>\n</ul>"},
+	}
+	for _, test := range tests {
+		if got := normalizeStorage(test.storage); got != test.want {
+			t.Errorf("normalizeStorage(%q) = %q, want %q", test.storage, got, test.want)
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+		lcs  int
+	}{
+		{"", "", 0},
+		{"a b c", "a b c", 3},
+		{"a b c", "", 0},
+		{"a b c a b b a", "c b a b a c", 4},
+		{"x a b y", "a x b", 2},
+		{"a b c d e f", "a c e g", 3},
+		{"p q r s", "s r q p", 1},
+	}
+	for _, test := range tests {
+		a, b := strings.Fields(test.a), strings.Fields(test.b)
+		var fromA, fromB []string
+		common := 0
+		for _, op := range diffLines(a, b) {
+			if op.kind != '+' {
+				fromA = append(fromA, op.line)
+			}
+			if op.kind != '-' {
+				fromB = append(fromB, op.line)
+			}
+			if op.kind == ' ' {
+				common++
+			}
+		}
+		if strings.Join(fromA, " ") != test.a || strings.Join(fromB, " ") != test.b {
+			t.Errorf("diffLines(%q, %q) does not turn one into the other", test.a, test.b)
+		}
+		if common != test.lcs {
+			t.Errorf("diffLines(%q, %q) keeps %d lines, want %d", test.a, test.b, common, test.lcs)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\nb", "a\nb", ""},
+		{"new page", "", "a\nb", "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"deleted content", "a\nb", "", "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"changed line", "a\nb\nc", "a\nx\nc", "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"added line", "a\nb", "a\nx\nb", "--- old\n+++ new\n@@ -1,2 +1,3 @@\n a\n+x\n b\n"},
+		{
+			"context is limited",
+			"1\n2\n3\n4\n5\n6\n7\n8",
+			"1\n2\n3\n4\nx\n6\n7\n8",
+			"--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n",
+		},
+		{
+			"separate hunks",
+			"a\n1\n2\n3\n4\n5\n6\n7\nb",
+			"x\n1\n2\n3\n4\n5\n6\n7\ny",
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n-a\n+x\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-b\n+y\n",
+		},
+		{
+			"close changes share a hunk",
+			"a\n1\n2\n3\nb",
+			"x\n1\n2\n3\ny",
+			"--- old\n+++ new\n@@ -1,5 +1,5 @@\n-a\n+x\n 1\n 2\n 3\n-b\n+y\n",
+		},
+	}
+	for _, test := range tests {
+		if got := unifiedDiff("old", "new", test.a, test.b); got != test.want {
+			t.Errorf("%s: unifiedDiff = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWordDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a b", "a b", ""},
+		{"changed word", "the quick fox", "the slow fox", "--- old\n+++ new\n@@ 1 @@\nthe [-quick-] {+slow+} fox\n"},
+		{"added words", "a b", "a x y b", "--- old\n+++ new\n@@ 1 @@\na {+x y+} b\n"},
+		{"only changed lines", "one\ntwo\nthree", "one\n2\nthree", "--- old\n+++ new\n@@ 2 @@\n[-two-] {+2+}\n"},
+		{"joined lines", "a\nb", "a b", "--- old\n+++ new\n@@ 1 @@\na b\n"},
+		{"whitespace only", "a  b", "a b", ""},
+	}
+	for _, test := range tests {
+		if got := wordDiff("old", "new", test.a, test.b); got != test.want {
+			t.Errorf("%s: wordDiff = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestStorageText(t *testing.T) {
+	tests := []struct {
+		storage string
+		want    string
+	}{
+		{"<p>Hello <strong>world</strong></p>", "Hello world"},
+		{"<h1>Title</h1><p>Body</p>", "Title\nBody"},
+	}
+	for _, test := range tests {
+		got, err := storageText(test.storage)
+		if err != nil {
+			t.Errorf("storageText(%q): %s", test.storage, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("storageText(%q) = %q, want %q", test.storage, got, test.want)
+		}
+	}
+}
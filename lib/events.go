@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Logger receives the progress and debug messages of a run. It is
+// implemented by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// writerLogger writes messages to a writer, as the command line does
+type writerLogger struct {
+	w io.Writer
+}
+
+func (l writerLogger) Printf(format string, v ...interface{}) {
+	fmt.Fprintf(l.w, format, v...)
+}
+
+// EventType identifies what happened to a page
+type EventType string
+
+const (
+	// EventPageRendered is sent when a markdown file was converted to storage format
+	EventPageRendered EventType = "page-rendered"
+	// EventPageCreated is sent when a page, including a folder page, was created
+	EventPageCreated EventType = "page-created"
+	// EventPageUpdated is sent when a new version of a page was published
+	EventPageUpdated EventType = "page-updated"
+	// EventAttachmentUploaded is sent for every attachment added to or updated on a page
+	EventAttachmentUploaded EventType = "attachment-uploaded"
+)
+
+// Event describes a step of publishing a page
+type Event struct {
+	Type EventType
+	// Path is the markdown file of the page, empty for folder pages without index file
+	Path   string
+	Title  string
+	Space  string
+	PageID string
+	// Version is the version of created and updated pages
+	Version int
+	// Attachment is the file name of an uploaded attachment
+	Attachment string
+}
+
+// logger returns the configured logger. It defaults to standard output, or
+// to standard error if standard output is reserved for the JSON report.
+func (m *Markdown2Confluence) logger() Logger {
+	if m.Logger != nil {
+		return m.Logger
+	}
+	if m.Output == OutputJSON {
+		return writerLogger{os.Stderr}
+	}
+	return writerLogger{m.stdout()}
+}
+
+// stdout returns the writer of the reports, diffs and rendered pages
+func (m *Markdown2Confluence) stdout() io.Writer {
+	if m.Stdout == nil {
+		return os.Stdout
+	}
+	return m.Stdout
+}
+
+// logf writes a message to the configured logger
+func (m *Markdown2Confluence) logf(format string, v ...interface{}) {
+	m.logger().Printf(format, v...)
+}
+
+// debugf writes a message if debug output is enabled
+func (m *Markdown2Confluence) debugf(format string, v ...interface{}) {
+	if m.Debug {
+		m.logf(format, v...)
+	}
+}
+
+// emit passes the event to the OnEvent callback, if there is one
+func (m *Markdown2Confluence) emit(event Event) {
+	if m.OnEvent != nil {
+		m.OnEvent(event)
+	}
+}
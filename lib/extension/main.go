@@ -8,6 +8,10 @@ import (
 	r "github.com/justmiles/go-markdown2confluence/lib/renderer"
 )
 
+// ConfluencePriority is the priority of the Confluence node renderers. Node
+// renderers with a lower value replace them.
+const ConfluencePriority = 100
+
 // Confluence is a Goldmark extension that renders markdown content compatable with Confluence
 type Confluence struct {
 	imageHTMLRender *r.ConfluenceImageHTMLRender
@@ -30,9 +34,9 @@ func (c *Confluence) Images() []string {
 func (c *Confluence) Extend(m goldmark.Markdown) {
 
 	m.Renderer().AddOptions(renderer.WithNodeRenderers(
-		util.Prioritized(r.NewConfluenceFencedCodeBlockHTMLRender(), 100),
-		util.Prioritized(r.NewConfluenceCodeBlockHTMLRender(), 100),
-		util.Prioritized(c.imageHTMLRender, 100),
+		util.Prioritized(r.NewConfluenceFencedCodeBlockHTMLRender(), ConfluencePriority),
+		util.Prioritized(r.NewConfluenceCodeBlockHTMLRender(), ConfluencePriority),
+		util.Prioritized(c.imageHTMLRender, ConfluencePriority),
 	))
 
 }
@@ -1,9 +1,14 @@
 package lib
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
 	"github.com/justmiles/go-confluence"
 )
@@ -14,6 +19,11 @@ type MarkdownFile struct {
 	Title    string
 	Parents  []string
 	Ancestor string
+	settings *Markdown2Confluence
+	// root is the id of the topmost parent page, if it is already known
+	root string
+	// order holds the ordering hints of the parents and the page
+	order []pageOrder
 }
 
 func (f *MarkdownFile) String() (urlPath string) {
@@ -28,48 +38,103 @@ func (f *MarkdownFile) FormattedPath() (s string) {
 	return s
 }
 
+// pageSettings returns the settings applying to this file, which may differ
+// from the run settings through directory overrides in the config file
+func (f *MarkdownFile) pageSettings(m *Markdown2Confluence) *Markdown2Confluence {
+	if f.settings != nil {
+		return f.settings
+	}
+	return m
+}
+
 // Upload a markdown file
 func (f *MarkdownFile) Upload(m *Markdown2Confluence) (urlPath string, err error) {
-	var ancestorID string
-	// Content of Wiki
-	dat, err := ioutil.ReadFile(f.Path)
+	result := f.upload(m)
+	return result.URL, result.Err
+}
+
+// upload publishes the markdown file and reports the outcome
+func (f *MarkdownFile) upload(m *Markdown2Confluence) UploadResult {
+	start := time.Now()
+	content, action, images, err := f.publish(m)
+
+	result := UploadResult{
+		File:    *f,
+		Action:  action,
+		Err:     err,
+		PageID:  content.ID,
+		Version: content.Version.Number,
+	}
+	if content.ID != "" {
+		result.URL = m.Endpoint + content.Links.Tinyui
+		result.WebURL = m.Endpoint + content.Links.Webui
+	}
 	if err != nil {
-		return urlPath, fmt.Errorf("Could not open file %s:\n\t%s", f.Path, err)
+		result.Action = ActionFailed
+	} else {
+		result.Attachments = images
 	}
+	result.Duration = time.Since(start)
+	return result
+}
 
-	if m.Debug {
-		fmt.Println(f.Path)
+// render converts the markdown file into storage format and returns it with
+// the local images it references and the version comment
+func (f *MarkdownFile) render(m *Markdown2Confluence) (wikiContent string, images []string, comment string, err error) {
+	settings := f.pageSettings(m)
+	// Content of Wiki
+	dat, err := m.readMarkdown(f.Path)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("Could not open file %s:\n\t%s", f.Path, err)
 	}
 
-	wikiContent := string(dat)
-	var images []string
-	wikiContent, images, err = renderContent(f.Path, wikiContent, m.WithHardWraps)
+	m.debugf("%s\n", f.Path)
+
+	// front matter configures the page, it is not part of its content
+	_, dat = splitFrontMatter(dat)
+
+	wikiContent, images, err = renderContent(f.Path, string(dat), settings.WithHardWraps, m.goldmark)
 
 	if err != nil {
-		return urlPath, fmt.Errorf("unable to render content from %s: %s", f.Path, err)
+		return "", nil, "", fmt.Errorf("unable to render content from %s: %s", f.Path, err)
 	}
 
-	if m.Debug {
-		fmt.Println("---- RENDERED CONTENT START ---------------------------------")
-		fmt.Println(wikiContent)
-		fmt.Println("---- RENDERED CONTENT END -----------------------------------")
-
-		for _, image := range images {
-			fmt.Printf("LOCAL IMAGE FOUND: %s\n", image)
+	comment = settings.Comment
+	if m.GitComment || m.GitFooter {
+		commit, err := gitLastCommit(f.Path)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("unable to read git history of %s: %s", f.Path, err)
+		}
+		if commit != nil && m.GitComment {
+			comment = commit.String()
+		}
+		if commit != nil && m.GitFooter {
+			footer, err := m.gitFooter(commit)
+			if err != nil {
+				return "", nil, "", err
+			}
+			wikiContent += footer
 		}
 	}
 
-	// search for existing page
-	contentResults, err := m.client.GetContent(&confluence.GetContentQueryParameters{
-		Title:    f.Title,
-		Spacekey: m.Space,
-		Limit:    1,
-		Type:     "page",
-		Expand:   []string{"version", "body.storage"},
-	})
+	m.debugf("---- RENDERED CONTENT START ---------------------------------\n%s\n---- RENDERED CONTENT END -----------------------------------\n", wikiContent)
+	for _, image := range images {
+		m.debugf("LOCAL IMAGE FOUND: %s\n", image)
+	}
+	return wikiContent, images, comment, nil
+}
+
+// publish renders the markdown file and creates or updates its page. It
+// returns the page and the local images attached to it.
+func (f *MarkdownFile) publish(m *Markdown2Confluence) (content confluence.Content, action Action, images []string, err error) {
+	var ancestorID string
+	settings := f.pageSettings(m)
+
+	wikiContent, images, comment, err := f.render(m)
 	if err != nil {
-		return urlPath, fmt.Errorf("Error checking for existing page: %s", err)
+		return content, ActionFailed, nil, err
 	}
+	m.emit(Event{Type: EventPageRendered, Path: f.Path, Title: f.Title, Space: settings.Space})
 
 	// if ancestor was set because parent is a page id
 	if f.Ancestor != "" {
@@ -79,41 +144,43 @@ func (f *MarkdownFile) Upload(m *Markdown2Confluence) (urlPath string, err error
 		if len(f.Parents) > 0 {
 			ancestorID, err = f.FindOrCreateAncestors(m)
 			if err != nil {
-				return urlPath, err
+				return content, ActionFailed, images, err
 			}
 		}
 	}
 
-	var content confluence.Content
-	var currContentID string
+	// search for existing page
+	contentResults, err := f.existingPage(m, settings.Space)
+	if err != nil {
+		return content, ActionFailed, images, err
+	}
+
 	// if page exists, update it
 	if len(contentResults) > 0 {
 		content = contentResults[0]
-		content.Version.Number++
-		content.Version.Message = m.Comment
-		content.Body.Storage.Representation = "storage"
-		content.Body.Storage.Value = wikiContent
-		content.Space.Key = m.Space
-		if ancestorID != "" {
-			content.Ancestors = append(content.Ancestors, Ancestor{
-				ID: ancestorID,
-			})
+		if err := m.checkConflict(f, content); err != nil {
+			return content, ActionFailed, images, err
 		}
 
-		content, err = m.client.UpdateContent(&content, nil)
-		if err != nil {
-			return urlPath, fmt.Errorf("Error updating content: %s", err)
+		// Confluence serializes the storage format it returns differently
+		action = ActionUnchanged
+		if normalizeStorage(content.Body.Storage.Value) != normalizeStorage(wikiContent) || !hasParent(content, ancestorID) {
+			content, err = f.update(m, content, wikiContent, ancestorID, comment)
+			if err != nil {
+				return content, ActionFailed, images, err
+			}
+			action = ActionUpdated
+			m.emit(Event{Type: EventPageUpdated, Path: f.Path, Title: f.Title, Space: settings.Space, PageID: content.ID, Version: content.Version.Number})
 		}
-		urlPath = m.client.Endpoint + content.Links.Tinyui
-		currContentID = content.ID
 
 		// if page does not exist, create it
 	} else {
+		action = ActionCreated
 
 		bp := confluence.CreateContentBodyParameters{}
 		bp.Title = f.Title
 		bp.Type = "page"
-		bp.Space.Key = m.Space
+		bp.Space.Key = settings.Space
 		bp.Body.Storage.Representation = "storage"
 		bp.Body.Storage.Value = wikiContent
 
@@ -123,81 +190,389 @@ func (f *MarkdownFile) Upload(m *Markdown2Confluence) (urlPath string, err error
 			})
 		}
 
-		content, err := m.client.CreateContent(&bp, nil)
+		content, err = m.Client.CreateContent(&bp, nil)
 		if err != nil {
-			return urlPath, fmt.Errorf("Error creating page: %s", err)
+			return content, ActionFailed, images, fmt.Errorf("Error creating page: %s", err)
 		}
-		urlPath = m.client.Endpoint + content.Links.Tinyui
-		currContentID = content.ID
+		m.emit(Event{Type: EventPageCreated, Path: f.Path, Title: f.Title, Space: settings.Space, PageID: content.ID, Version: content.Version.Number})
 	}
 
-	_, errors := m.client.AddUpdateAttachments(currContentID, images)
+	m.recordPublished(f, content, wikiContent)
+
+	if len(settings.Labels) > 0 {
+		if err := m.Client.AddLabels(content.ID, settings.Labels, confluence.GlobalPrefix); err != nil {
+			return content, ActionFailed, images, fmt.Errorf("Error adding labels: %s", err)
+		}
+	}
+
+	attachments, errors := m.Client.AddUpdateAttachments(content.ID, images)
+	for _, attachment := range attachments {
+		m.emit(Event{Type: EventAttachmentUploaded, Path: f.Path, Title: f.Title, Space: settings.Space, PageID: content.ID, Attachment: attachment.Title})
+	}
 	if len(errors) > 0 {
-		fmt.Println(errors)
+		m.logf("%s\n", errors)
 		err = errors[0]
 	}
 
-	return urlPath, err
+	return content, action, images, err
+}
+
+// existingPage searches for the page of the file. If a page with its title
+// exists outside of the published tree, or at the top of the space without
+// being recorded in the state file, the title is disambiguated according to
+// the title strategy.
+func (f *MarkdownFile) existingPage(m *Markdown2Confluence, space string) ([]confluence.Content, error) {
+	root := f.treeRoot(m)
+	for renamed := false; ; renamed = true {
+		contentResults, err := m.Client.GetContent(&confluence.GetContentQueryParameters{
+			Title:    f.Title,
+			Spacekey: space,
+			Limit:    1,
+			Type:     "page",
+			Expand:   []string{"version", "body.storage", "ancestors"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Error checking for existing page: %s", err)
+		}
+		if len(contentResults) == 0 {
+			return nil, nil
+		}
+		content := contentResults[0]
+		if !outsideTree(content, root) && (root != "" || m.publishedBefore(content.ID)) {
+			return contentResults, nil
+		}
+
+		title := strategyTitle(m.TitleStrategy, deleteEmpty(f.Parents), f.Title)
+		if renamed || m.TitleStrategy == "" || m.TitleStrategy == TitleStrategyFail || title == f.Title {
+			return nil, titleCollision(f.Title, content)
+		}
+		m.debugf("Page %s exists outside of the published pages, publishing %s as %q\n", f.Title, f.Path, title)
+		f.Title = title
+	}
+}
+
+// publishedBefore reports whether a page at the top of the space may have
+// been published by a previous run. Any page may if there is no state file or
+// it records no pages yet.
+func (m *Markdown2Confluence) publishedBefore(id string) bool {
+	if m.state == nil || m.state.Empty() {
+		return true
+	}
+	_, ok := m.state.Get(id)
+	return ok
+}
+
+// checkConflict applies the conflict policy if the page was edited in
+// Confluence since it was last published. Newer versions with the body that
+// was published, e.g. after the page was moved, are no conflict.
+func (m *Markdown2Confluence) checkConflict(f *MarkdownFile, content confluence.Content) error {
+	if m.state == nil {
+		return nil
+	}
+
+	published, ok := m.state.Get(content.ID)
+	if !ok || content.Version.Number <= published.Version {
+		return nil
+	}
+	if normalizeStorage(content.Body.Storage.Value) == normalizeStorage(published.Body) {
+		return nil
+	}
+
+	msg := fmt.Sprintf("page %s was edited in Confluence since it was last published (version %d, last published version %d)", f.Title, content.Version.Number, published.Version)
+	diff := unifiedDiff(
+		fmt.Sprintf("%s (version %d)", f.Title, published.Version),
+		fmt.Sprintf("%s (version %d)", f.Title, content.Version.Number),
+		normalizeStorage(published.Body),
+		normalizeStorage(content.Body.Storage.Value),
+	)
+
+	switch m.OnConflict {
+	case ConflictOverwrite:
+		m.debugf("%s, overwriting\n", msg)
+		return nil
+	case ConflictWarn:
+		m.logf("Warning: %s, overwriting remote changes:\n%s", msg, diff)
+		return nil
+	default:
+		return fmt.Errorf("%s, use --on-conflict to overwrite it:\n%s", msg, diff)
+	}
+}
+
+// recordPublished remembers the version of a page published by this run
+func (m *Markdown2Confluence) recordPublished(f *MarkdownFile, content confluence.Content, wikiContent string) {
+	if m.state == nil {
+		return
+	}
+
+	body := content.Body.Storage.Value
+	if body == "" {
+		body = wikiContent
+	}
+	m.state.Record(content.ID, PublishedPage{
+		Title:   f.Title,
+		Version: content.Version.Number,
+		Body:    body,
+	})
+}
+
+// update writes a new version of an existing page. If the page was changed
+// in the meantime, the update is retried against the latest version.
+func (f *MarkdownFile) update(m *Markdown2Confluence, content confluence.Content, wikiContent, ancestorID, comment string) (confluence.Content, error) {
+	space := f.pageSettings(m).Space
+	for attempt := 1; ; attempt++ {
+		next := content
+		next.Version.Number++
+		next.Version.Message = comment
+		next.Body.Storage.Representation = "storage"
+		next.Body.Storage.Value = wikiContent
+		next.Space.Key = space
+		// only send the ancestors when the page has to be moved
+		next.Ancestors = nil
+		if ancestorID != "" {
+			next.Ancestors = append(next.Ancestors, Ancestor{
+				ID: ancestorID,
+			})
+		}
+
+		updated, err := m.Client.UpdateContent(&next, nil)
+		if err == nil {
+			return updated, nil
+		}
+		if !isConflict(err) || attempt >= m.retryAttempts() {
+			return updated, fmt.Errorf("Error updating content: %s", err)
+		}
+
+		// Confluence rejects updates that do not increment the latest version,
+		// so check whether somebody else published in the meantime
+		contentResults, fetchErr := m.Client.GetContent(&confluence.GetContentQueryParameters{
+			Title:    f.Title,
+			Spacekey: space,
+			Limit:    1,
+			Type:     "page",
+			Expand:   []string{"version", "body.storage"},
+		})
+		if fetchErr != nil || len(contentResults) == 0 || contentResults[0].ID != content.ID || contentResults[0].Version.Number == content.Version.Number {
+			return updated, fmt.Errorf("Error updating content: %s", err)
+		}
+		// the new version may be an edit made in Confluence
+		if err := m.checkConflict(f, contentResults[0]); err != nil {
+			return updated, err
+		}
+
+		m.debugf("Version conflict updating %s, retrying against version %d\n", f.Title, contentResults[0].Version.Number)
+		content.Version = contentResults[0].Version
+	}
+}
+
+// hasParent reports whether content is a direct child of ancestorID. An empty
+// ancestorID leaves the current parent untouched and always matches.
+func hasParent(content confluence.Content, ancestorID string) bool {
+	if ancestorID == "" {
+		return true
+	}
+	if len(content.Ancestors) == 0 {
+		return false
+	}
+	return content.Ancestors[len(content.Ancestors)-1].ID == ancestorID
 }
 
 // FindOrCreateAncestors creates an empty page to represent a local "folder" name
 func (f *MarkdownFile) FindOrCreateAncestors(m *Markdown2Confluence) (ancestorID string, err error) {
 
+	var path []string
 	for _, parent := range f.Parents {
-		ancestorID, err = f.FindOrCreateAncestor(m, m.client, ancestorID, parent)
+		ancestorID, err = f.FindOrCreateAncestor(m, m.Client, ancestorID, path, parent)
 		if err != nil {
 			return "", err
 		}
+		if parent != "" {
+			path = append(path, parent)
+		}
 	}
 
 	// Return the last ancestorID
 	return ancestorID, nil
 }
 
-// ParentIndex caches parent page Ids for futures reference
-var ParentIndex = make(map[string]string)
+// parentIndex caches parent page IDs for the duration of a run. Entries are
+// keyed by space and the full ancestor path so that identically named folders
+// in different locations are never confused with one another.
+type parentIndex struct {
+	sync.Mutex
+	ids    map[string]string
+	titles map[string]string
+	// published holds the results of folder pages published from index files
+	published map[string]UploadResult
+	// pending holds the parents that are being resolved, so that concurrent
+	// uploads wait for them instead of creating the same page twice
+	pending map[string]*pendingParent
+}
+
+// pendingParent is a parent page that is being looked up or created
+type pendingParent struct {
+	done chan struct{}
+	id   string
+	err  error
+}
+
+func newParentIndex() *parentIndex {
+	return &parentIndex{
+		ids:       make(map[string]string),
+		titles:    make(map[string]string),
+		published: make(map[string]UploadResult),
+		pending:   make(map[string]*pendingParent),
+	}
+}
+
+// Published returns the result of a folder page published from an index file
+func (p *parentIndex) Published(key string) (UploadResult, bool) {
+	p.Lock()
+	defer p.Unlock()
+	result, ok := p.published[key]
+	return result, ok
+}
+
+// ID returns the page id of a resolved parent, or an empty string
+func (p *parentIndex) ID(key string) string {
+	p.Lock()
+	defer p.Unlock()
+	return p.ids[key]
+}
+
+func parentIndexKey(space string, path []string, parent string) string {
+	return space + ":" + strings.Join(append(append([]string{}, path...), parent), "/")
+}
 
 // FindOrCreateAncestor creates an empty page to represent a local "folder" name
-func (f *MarkdownFile) FindOrCreateAncestor(m *Markdown2Confluence, client *confluence.Client, ancestorID, parent string) (string, error) {
+func (f *MarkdownFile) FindOrCreateAncestor(m *Markdown2Confluence, client Client, ancestorID string, path []string, parent string) (string, error) {
 	if parent == "" {
 		return "", nil
 	}
 
-	if val, ok := ParentIndex[parent]; ok {
+	// Resolve every ancestor once, uploads of other files needing it wait
+	// for the result. The lock only guards the index, not the API calls.
+	index := m.parents
+	space := f.pageSettings(m).Space
+	key := parentIndexKey(space, path, parent)
+	titleKey := space + ":" + parent
+
+	index.Lock()
+	if val, ok := index.ids[key]; ok {
+		index.Unlock()
 		return val, nil
 	}
+	if pending, ok := index.pending[key]; ok {
+		index.Unlock()
+		<-pending.done
+		return pending.id, pending.err
+	}
 
-	if m.Debug {
-		fmt.Printf("Searching for parent %s\n", parent)
+	// Confluence titles are unique per space, so two folders with the same name
+	// in different locations can not both be represented by a page
+	if other, ok := index.titles[titleKey]; ok && other != key {
+		index.Unlock()
+		return "", fmt.Errorf("parent page %s for %s conflicts with %s: page titles must be unique within a space", key, f.Path, other)
 	}
 
-	contentResults, err := client.GetContent(&confluence.GetContentQueryParameters{
-		Title:    parent,
-		Spacekey: m.Space,
-		Limit:    1,
-		Type:     "page",
-	})
-	if err != nil {
-		return "", fmt.Errorf("Error checking for parent page: %s", err)
+	// pages outside of the tree below the topmost parent are not reused
+	var root string
+	if len(path) > 0 {
+		root = index.ids[parentIndexKey(space, nil, path[0])]
 	}
 
-	if len(contentResults) > 0 {
+	pending := &pendingParent{done: make(chan struct{})}
+	index.pending[key] = pending
+	index.titles[titleKey] = key
+	index.Unlock()
+
+	pending.id, pending.err = f.resolveAncestor(m, client, ancestorID, path, parent, root)
+
+	index.Lock()
+	delete(index.pending, key)
+	if pending.err == nil {
+		index.ids[key] = pending.id
+	} else if index.titles[titleKey] == key {
+		delete(index.titles, titleKey)
+	}
+	index.Unlock()
+	close(pending.done)
+	return pending.id, pending.err
+}
+
+// resolveAncestor finds or creates the page of the parent folder below
+// ancestorID. A folder with an index file is published from it.
+func (f *MarkdownFile) resolveAncestor(m *Markdown2Confluence, client Client, ancestorID string, path []string, parent, root string) (string, error) {
+	space := f.pageSettings(m).Space
+	key := parentIndexKey(space, path, parent)
+
+	// if the folder has an index file, it becomes the body of the folder page
+	if indexPath, ok := m.folderIndexes[key]; ok {
+		settings, ok := m.indexSettings[indexPath]
+		if !ok {
+			settings = f.pageSettings(m).settingsFor(indexPath)
+		}
+		folder := MarkdownFile{
+			Path:     indexPath,
+			Title:    parent,
+			Parents:  path,
+			Ancestor: ancestorID,
+			settings: settings,
+			root:     root,
+		}
+		result := folder.upload(m)
+		if result.Err != nil {
+			return "", fmt.Errorf("Error publishing parent page %s from %s: %s", parent, indexPath, result.Err)
+		}
+		m.parents.Lock()
+		m.parents.published[key] = result
+		m.parents.Unlock()
+		return result.PageID, nil
+	}
+
+	m.debugf("Searching for parent %s\n", parent)
+
+	title := parent
+	for renamed := false; ; renamed = true {
+		contentResults, err := client.GetContent(&confluence.GetContentQueryParameters{
+			Title:    title,
+			Spacekey: space,
+			Limit:    1,
+			Type:     "page",
+			Expand:   []string{"ancestors"},
+		})
+		if err != nil {
+			return "", fmt.Errorf("Error checking for parent page: %s", err)
+		}
+		if len(contentResults) == 0 {
+			break
+		}
+
 		content := contentResults[0]
-		ParentIndex[parent] = content.ID
-		return content.ID, err
+		if !outsideTree(content, root) {
+			return content.ID, nil
+		}
+
+		disambiguated := strategyTitle(m.TitleStrategy, path, parent)
+		if renamed || m.TitleStrategy == "" || m.TitleStrategy == TitleStrategyFail || disambiguated == parent {
+			return "", titleCollision(title, content)
+		}
+		title = disambiguated
 	}
 
 	// if parent page does not exist, create it
+	body, images, err := m.folderPageContent(path, parent)
+	if err != nil {
+		return "", fmt.Errorf("Error rendering parent page %s for %s: %s", parent, f.Path, err)
+	}
+
 	bp := confluence.CreateContentBodyParameters{}
-	bp.Title = parent
+	bp.Title = title
 	bp.Type = "page"
-	bp.Space.Key = m.Space
+	bp.Space.Key = space
 	bp.Body.Storage.Representation = "storage"
-	bp.Body.Storage.Value = defaultAncestorPage
+	bp.Body.Storage.Value = body
 
-	if m.Debug {
-		fmt.Printf("Creating parent page '%s' with ancestor id %s\n", bp.Title, ancestorID)
-	}
+	m.debugf("Creating parent page '%s' with ancestor id %s\n", bp.Title, ancestorID)
 
 	if ancestorID != "" {
 		bp.Ancestors = append(bp.Ancestors, Ancestor{
@@ -209,20 +584,79 @@ func (f *MarkdownFile) FindOrCreateAncestor(m *Markdown2Confluence, client *conf
 	if err != nil {
 		return "", fmt.Errorf("Error creating parent page %s for %s: %s", f.Path, bp.Title, err)
 	}
-	ParentIndex[parent] = content.ID
+	m.emit(Event{Type: EventPageCreated, Title: bp.Title, Space: space, PageID: content.ID, Version: content.Version.Number})
+
+	attachments, errors := client.AddUpdateAttachments(content.ID, images)
+	for _, attachment := range attachments {
+		m.emit(Event{Type: EventAttachmentUploaded, Title: bp.Title, Space: space, PageID: content.ID, Attachment: attachment.Title})
+	}
+	if len(errors) > 0 {
+		return "", fmt.Errorf("Error uploading attachments to parent page %s: %s", bp.Title, errors[0])
+	}
+
 	return content.ID, nil
 }
 
+// folderPageData is passed to the folder page templates
+type folderPageData struct {
+	Title   string
+	Parents []string
+	Sort    string
+	Depth   int
+}
+
+// folderPageContent renders the body of a folder page that has no index file,
+// either from the configured template or the default children macro
+func (m *Markdown2Confluence) folderPageContent(parents []string, title string) (body string, images []string, err error) {
+	data := folderPageData{
+		Title:   title,
+		Parents: parents,
+		Sort:    m.FolderSort,
+		Depth:   m.FolderDepth,
+	}
+
+	if m.FolderTemplate == "" {
+		var buf bytes.Buffer
+		err = defaultAncestorTemplate.Execute(&buf, data)
+		return buf.String(), nil, err
+	}
+
+	dat, err := ioutil.ReadFile(m.FolderTemplate)
+	if err != nil {
+		return "", nil, fmt.Errorf("Could not open folder template %s:\n\t%s", m.FolderTemplate, err)
+	}
+
+	t, err := template.New(filepath.Base(m.FolderTemplate)).Parse(string(dat))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, data); err != nil {
+		return "", nil, err
+	}
+
+	return renderContent(m.FolderTemplate, buf.String(), m.WithHardWraps, m.goldmark)
+}
+
 // Ancestor TODO: move this to go-confluence api
 type Ancestor struct {
 	ID string `json:"id,omitempty"`
 }
 
+var defaultAncestorTemplate = template.Must(template.New("folder").Parse(defaultAncestorPage))
+
 const defaultAncestorPage = `
 <p>
    <ac:structured-macro ac:name="children" ac:schema-version="2" ac:macro-id="a93cdc19-61cd-4c21-8da7-0af3c6b76c07">
+      {{- if .Depth }}
+      <ac:parameter ac:name="depth">{{ .Depth }}</ac:parameter>
+      {{- else }}
       <ac:parameter ac:name="all">true</ac:parameter>
-      <ac:parameter ac:name="sort">title</ac:parameter>
+      {{- end }}
+      {{- if .Sort }}
+      <ac:parameter ac:name="sort">{{ .Sort }}</ac:parameter>
+      {{- end }}
    </ac:structured-macro>
 </p>
 `
@@ -0,0 +1,191 @@
+package lib
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/justmiles/go-confluence"
+)
+
+// updateClient rejects updates with the queued errors. Every fetch of page 1
+// finds a newer version, starting with version 5.
+type updateClient struct {
+	Client
+	errs    []error
+	updates int
+	fetches int
+}
+
+func (c *updateClient) UpdateContent(content *confluence.Content, qp *confluence.QueryParameters) (confluence.Content, error) {
+	c.updates++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return *content, err
+	}
+	return *content, nil
+}
+
+func (c *updateClient) GetContent(qp *confluence.GetContentQueryParameters) ([]confluence.Content, error) {
+	content := confluence.Content{ID: "1", Title: qp.Title}
+	content.Version.Number = 5 + c.fetches
+	c.fetches++
+	return []confluence.Content{content}, nil
+}
+
+func TestUpdateRetries(t *testing.T) {
+	conflict := &APIError{StatusCode: http.StatusConflict, Message: "Version must be incremented on update"}
+
+	tests := []struct {
+		name     string
+		attempts int
+		errs     []error
+		updates  int
+		version  int
+		wantErr  bool
+	}{
+		{"success", 0, nil, 1, 4, false},
+		{"conflict retried against the latest version", 0, []error{conflict}, 2, 6, false},
+		{"server error not retried", 0, []error{&APIError{StatusCode: http.StatusInternalServerError, Message: "boom"}}, 1, 0, true},
+		{"other error not retried", 0, []error{errors.New("connection reset")}, 1, 0, true},
+		{"attempts exhausted", 2, []error{conflict, conflict}, 2, 0, true},
+		{"default attempts", 0, []error{conflict, conflict, conflict, conflict, conflict}, DefaultRetryAttempts, 0, true},
+	}
+	for _, test := range tests {
+		client := &updateClient{errs: test.errs}
+		m := &Markdown2Confluence{Client: client, RetryAttempts: test.attempts}
+		f := &MarkdownFile{Title: "Page"}
+		content := confluence.Content{ID: "1", Title: "Page"}
+		content.Version.Number = 3
+
+		updated, err := f.update(m, content, "<p>body</p>", "", "")
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: update error = %v, want error %t", test.name, err, test.wantErr)
+		}
+		if client.updates != test.updates {
+			t.Errorf("%s: %d updates, want %d", test.name, client.updates, test.updates)
+		}
+		if !test.wantErr && updated.Version.Number != test.version {
+			t.Errorf("%s: updated version %d, want %d", test.name, updated.Version.Number, test.version)
+		}
+	}
+}
+
+// pageClient finds page 7 with the given ancestors for every title
+type pageClient struct {
+	Client
+	ancestors []string
+}
+
+func (c *pageClient) GetContent(qp *confluence.GetContentQueryParameters) ([]confluence.Content, error) {
+	content := confluence.Content{ID: "7", Title: qp.Title}
+	content.Ancestors = make([]struct {
+		ID string `json:"id,omitempty"`
+	}, len(c.ancestors))
+	for i, id := range c.ancestors {
+		content.Ancestors[i].ID = id
+	}
+	return []confluence.Content{content}, nil
+}
+
+func TestExistingPage(t *testing.T) {
+	tests := []struct {
+		name      string
+		root      string
+		ancestors []string
+		state     map[string]PublishedPage
+		wantErr   bool
+	}{
+		{"top of the space", "", nil, nil, false},
+		{"top with ancestors", "", []string{"3"}, nil, true},
+		{"top recorded in the state", "", nil, map[string]PublishedPage{"7": {Version: 1}}, false},
+		{"top not recorded in the state", "", nil, map[string]PublishedPage{"8": {Version: 1}}, true},
+		{"top with empty state", "", nil, map[string]PublishedPage{}, false},
+		{"below the root", "3", []string{"1", "3"}, nil, false},
+		{"outside of the root", "3", []string{"1", "4"}, nil, true},
+	}
+	for _, test := range tests {
+		m := &Markdown2Confluence{Client: &pageClient{ancestors: test.ancestors}}
+		if test.state != nil {
+			m.state = &State{Pages: test.state}
+		}
+		f := &MarkdownFile{Title: "Page", root: test.root}
+
+		pages, err := f.existingPage(m, "SP")
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: existingPage error = %v, want error %t", test.name, err, test.wantErr)
+		}
+		if !test.wantErr && (len(pages) != 1 || pages[0].ID != "7") {
+			t.Errorf("%s: existingPage = %v, want page 7", test.name, pages)
+		}
+	}
+}
+
+// storageClient returns page 7 with the given body and counts the updates.
+// The page has no attachments.
+type storageClient struct {
+	Client
+	body    string
+	updates int
+}
+
+func (c *storageClient) GetContent(qp *confluence.GetContentQueryParameters) ([]confluence.Content, error) {
+	content := confluence.Content{ID: "7", Title: qp.Title}
+	content.Body.Storage.Value = c.body
+	content.Version.Number = 2
+	return []confluence.Content{content}, nil
+}
+
+func (c *storageClient) UpdateContent(content *confluence.Content, qp *confluence.QueryParameters) (confluence.Content, error) {
+	c.updates++
+	return *content, nil
+}
+
+func (c *storageClient) AddUpdateAttachments(id string, files []string) ([]*confluence.Attachment, []error) {
+	return nil, nil
+}
+
+func TestPublishUnchanged(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "page.md")
+	if err := os.WriteFile(p, []byte("# Title\n\nSome *text*.\n\n- a\n- b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &Markdown2Confluence{Client: &storageClient{}, Space: "SP"}
+	if err := m.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	f := &MarkdownFile{Path: p, Title: "Page"}
+	wikiContent, _, _, err := f.render(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		action Action
+	}{
+		{"same storage", wikiContent, ActionUnchanged},
+		{"re-serialized storage", "\n  " + strings.ReplaceAll(wikiContent, "><", ">\n    <") + "\n", ActionUnchanged},
+		{"changed storage", strings.Replace(wikiContent, "text", "other text", 1), ActionUpdated},
+	}
+	for _, test := range tests {
+		client := &storageClient{body: test.body}
+		m.Client = client
+		_, action, _, err := f.publish(m)
+		if err != nil {
+			t.Errorf("%s: publish error = %v", test.name, err)
+			continue
+		}
+		if action != test.action {
+			t.Errorf("%s: publish action = %v, want %v", test.name, action, test.action)
+		}
+		if updates := client.updates; (updates > 0) != (test.action == ActionUpdated) {
+			t.Errorf("%s: %d updates for action %v", test.name, updates, test.action)
+		}
+	}
+}
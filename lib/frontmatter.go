@@ -0,0 +1,41 @@
+package lib
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v3"
+)
+
+// splitFrontMatter separates a YAML front matter block delimited by --- lines
+// from the markdown source. It returns the source unchanged if there is none,
+// or if the block is not a YAML mapping, as --- is a thematic break as well.
+func splitFrontMatter(source []byte) (frontMatter map[string]interface{}, body []byte) {
+	normalized := bytes.ReplaceAll(source, []byte("\r\n"), []byte("\n"))
+	if !bytes.HasPrefix(normalized, []byte("---\n")) {
+		return nil, source
+	}
+
+	rest := normalized[len("---\n"):]
+	end := bytes.Index(rest, []byte("\n---\n"))
+	offset := len("\n---\n")
+	if bytes.HasPrefix(rest, []byte("---\n")) {
+		end, offset = 0, len("---\n")
+	} else if end < 0 && bytes.HasSuffix(rest, []byte("\n---")) {
+		end, offset = len(rest)-len("\n---"), len("\n---")
+	}
+	if end < 0 {
+		return nil, source
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(rest[:end], &node); err != nil {
+		return nil, source
+	}
+	frontMatter = make(map[string]interface{})
+	if len(node.Content) > 0 {
+		if node.Content[0].Kind != yaml.MappingNode || node.Content[0].Decode(&frontMatter) != nil {
+			return nil, source
+		}
+	}
+	return frontMatter, rest[end+offset:]
+}
@@ -0,0 +1,35 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		frontMatter map[string]interface{}
+		body        string
+	}{
+		{"no front matter", "# Title\n", nil, "# Title\n"},
+		{"front matter", "---\ntitle: Guide\nweight: 2\n---\n# Title\n", map[string]interface{}{"title": "Guide", "weight": 2}, "# Title\n"},
+		{"crlf line endings", "---\r\ntitle: Guide\r\n---\r\nbody\r\n", map[string]interface{}{"title": "Guide"}, "body\n"},
+		{"empty front matter", "---\n---\nbody\n", map[string]interface{}{}, "body\n"},
+		{"front matter only", "---\ntitle: Guide\n---", map[string]interface{}{"title": "Guide"}, ""},
+		{"unterminated", "---\ntitle: Guide\n", nil, "---\ntitle: Guide\n"},
+		{"thematic break", "---\n\nSome text\n\n---\n\nMore text\n", nil, "---\n\nSome text\n\n---\n\nMore text\n"},
+		{"setext heading", "---\nHeading\n---\nbody\n", nil, "---\nHeading\n---\nbody\n"},
+		{"invalid yaml", "---\n- a\n  b: [\n---\nbody\n", nil, "---\n- a\n  b: [\n---\nbody\n"},
+		{"list", "---\n- a\n- b\n---\nbody\n", nil, "---\n- a\n- b\n---\nbody\n"},
+	}
+	for _, test := range tests {
+		frontMatter, body := splitFrontMatter([]byte(test.source))
+		if !reflect.DeepEqual(frontMatter, test.frontMatter) {
+			t.Errorf("%s: front matter = %#v, want %#v", test.name, frontMatter, test.frontMatter)
+		}
+		if string(body) != test.body {
+			t.Errorf("%s: body = %q, want %q", test.name, body, test.body)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+// git runs a git command in dir and returns its trimmed output
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// gitChangedFiles adds the absolute paths of all files that changed between
+// ref and HEAD in the repository at root to changed
+func gitChangedFiles(root, ref string, changed map[string]bool) error {
+	out, err := git(root, "diff", "--name-only", "--no-renames", ref, "HEAD", "--")
+	if err != nil {
+		return err
+	}
+	for _, name := range strings.Split(out, "\n") {
+		if name != "" {
+			changed[filepath.Join(root, filepath.FromSlash(name))] = true
+		}
+	}
+	return nil
+}
+
+// filterChanged returns the markdown files that changed since m.ChangedSince,
+// along with the files whose links or images point at changed files. Sources
+// in different repositories are compared with ref in their own repository.
+func (m *Markdown2Confluence) filterChanged(markdownFiles []MarkdownFile) ([]MarkdownFile, error) {
+	var (
+		changed = make(map[string]bool)
+		// repository root of every directory and the roots already diffed
+		roots  = make(map[string]string)
+		diffed = make(map[string]bool)
+	)
+	for _, markdownFile := range markdownFiles {
+		dir, err := filepath.Abs(filepath.Dir(markdownFile.Path))
+		if err != nil {
+			return nil, err
+		}
+		root, ok := roots[dir]
+		if !ok {
+			if root, err = git(dir, "rev-parse", "--show-toplevel"); err != nil {
+				return nil, fmt.Errorf("Unable to determine files changed since %s: %s", m.ChangedSince, err)
+			}
+			roots[dir] = root
+		}
+		if diffed[root] {
+			continue
+		}
+		if err := gitChangedFiles(root, m.ChangedSince, changed); err != nil {
+			return nil, fmt.Errorf("Unable to determine files changed since %s in %s: %s", m.ChangedSince, root, err)
+		}
+		diffed[root] = true
+	}
+
+	var filtered []MarkdownFile
+	for _, markdownFile := range markdownFiles {
+		dependency, err := m.changedDependency(markdownFile.Path, changed)
+		if err != nil {
+			return nil, err
+		}
+		if dependency == "" {
+			m.debugf("skipping %s: not changed since %s\n", markdownFile.Path, m.ChangedSince)
+			continue
+		}
+		m.debugf("including %s: %s changed since %s\n", markdownFile.Path, dependency, m.ChangedSince)
+		filtered = append(filtered, markdownFile)
+	}
+	return filtered, nil
+}
+
+// changedDependency returns the path of the markdown file itself or of a
+// local file it references if that changed, or an empty string otherwise
+func (m *Markdown2Confluence) changedDependency(p string, changed map[string]bool) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	if changed[abs] {
+		return abs, nil
+	}
+
+	references, err := m.localReferences(p)
+	if err != nil {
+		return "", err
+	}
+	for _, reference := range references {
+		if changed[reference] {
+			return reference, nil
+		}
+	}
+	return "", nil
+}
+
+// localReferences returns the absolute paths of all local files linked or
+// embedded as images by the markdown file at p
+func (m *Markdown2Confluence) localReferences(p string) ([]string, error) {
+	source, err := m.readMarkdown(p)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open file %s:\n\t%s", p, err)
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+
+	md := goldmark.New(goldmark.WithExtensions(extension.GFM))
+	doc := md.Parser().Parse(text.NewReader(source))
+
+	var references []string
+	err = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		var destination string
+		switch node := n.(type) {
+		case *ast.Image:
+			destination = string(node.Destination)
+		case *ast.Link:
+			destination = string(node.Destination)
+		default:
+			return ast.WalkContinue, nil
+		}
+
+		if reference := localDestination(abs, destination); reference != "" {
+			references = append(references, reference)
+		}
+		return ast.WalkContinue, nil
+	})
+	return references, err
+}
+
+// localDestination resolves a link or image destination relative to the
+// markdown file at p, returning an empty string for remote destinations
+func localDestination(p, destination string) string {
+	if destination == "" || strings.HasPrefix(destination, "#") || strings.Contains(destination, "://") || strings.HasPrefix(destination, "mailto:") {
+		return ""
+	}
+
+	// drop anchors and query strings
+	if i := strings.IndexAny(destination, "#?"); i >= 0 {
+		destination = destination[:i]
+	}
+	if unescaped, err := url.PathUnescape(destination); err == nil {
+		destination = unescaped
+	}
+
+	if filepath.IsAbs(destination) {
+		return filepath.Clean(destination)
+	}
+	return filepath.Join(filepath.Dir(p), filepath.FromSlash(destination))
+}
+
+// GitCommit describes the last commit that touched a file
+type GitCommit struct {
+	Hash      string
+	ShortHash string
+	Author    string
+	Email     string
+	Date      time.Time
+	Subject   string
+	// Path of the file relative to the repository root
+	Path string
+}
+
+// String formats the commit as a version comment
+func (c *GitCommit) String() string {
+	return fmt.Sprintf("%s %s: %s", c.ShortHash, c.Author, c.Subject)
+}
+
+// gitLastCommit returns the last commit that touched the file at p, or nil if
+// the file has not been committed
+func gitLastCommit(p string) (*GitCommit, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(abs)
+
+	// --name-only appends the path relative to the repository root
+	out, err := git(dir, "-c", "core.quotePath=false", "log", "-1", "--name-only", "--format=%H%x00%h%x00%an%x00%ae%x00%aI%x00%s%x00", "--", abs)
+	if err != nil {
+		return nil, err
+	}
+	if out == "" {
+		return nil, nil
+	}
+
+	fields := strings.SplitN(out, "\x00", 7)
+	if len(fields) != 7 {
+		return nil, fmt.Errorf("unexpected git log output for %s: %q", p, out)
+	}
+	date, err := time.Parse(time.RFC3339, fields[4])
+	if err != nil {
+		return nil, err
+	}
+
+	return &GitCommit{
+		Hash:      fields[0],
+		ShortHash: fields[1],
+		Author:    fields[2],
+		Email:     fields[3],
+		Date:      date,
+		Subject:   fields[5],
+		Path:      strings.TrimSpace(fields[6]),
+	}, nil
+}
+
+// gitFooter renders a footer linking the page to the commit it was published from
+func (m *Markdown2Confluence) gitFooter(commit *GitCommit) (string, error) {
+	changed := html.EscapeString(commit.ShortHash)
+	if m.repoURLTemplate != nil {
+		var u bytes.Buffer
+		if err := m.repoURLTemplate.Execute(&u, commit); err != nil {
+			return "", fmt.Errorf("unable to render repository url for %s: %s", commit.Path, err)
+		}
+		changed = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(u.String()), changed)
+	}
+
+	return fmt.Sprintf(`<hr /><p><em>Last changed by %s at %s in %s: %s</em></p>`,
+		html.EscapeString(commit.Author),
+		html.EscapeString(commit.Date.Format("2006-01-02 15:04 MST")),
+		changed,
+		html.EscapeString(commit.Subject),
+	), nil
+}
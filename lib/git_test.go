@@ -0,0 +1,31 @@
+package lib
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalDestination(t *testing.T) {
+	p := filepath.FromSlash("/docs/guide/index.md")
+	tests := []struct {
+		destination string
+		want        string
+	}{
+		{"", ""},
+		{"#anchor", ""},
+		{"https://example.com/a.md", ""},
+		{"mailto:someone@example.com", ""},
+		{"install.md", "/docs/guide/install.md"},
+		{"../images/a.png#frag", "/docs/images/a.png"},
+		{"install.md?raw=1", "/docs/guide/install.md"},
+		{"my%20file.md", "/docs/guide/my file.md"},
+		{"100%.md", "/docs/guide/100%.md"},
+		{"/abs/./b.md", "/abs/b.md"},
+	}
+	for _, test := range tests {
+		want := filepath.FromSlash(test.want)
+		if got := localDestination(p, test.destination); got != want {
+			t.Errorf("localDestination(%q) = %q, want %q", test.destination, got, want)
+		}
+	}
+}
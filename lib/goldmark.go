@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// GoldmarkExtension adds syntax and rendering to the goldmark pipeline that
+// converts markdown into storage format. Node renderers with a lower priority
+// replace those of the same node kinds with a higher one. The renderers of
+// the Confluence extension have priority extension.ConfluencePriority, the
+// default HTML renderers 1000. Pages are rendered concurrently, so all values
+// have to be safe for concurrent use.
+type GoldmarkExtension struct {
+	Extensions    []goldmark.Extender
+	ParserOptions []parser.Option
+	NodeRenderers []util.PrioritizedValue
+}
+
+// goldmarkExtensions holds the extensions that can be enabled by name with
+// --goldmark-extension and the config file
+var goldmarkExtensions = struct {
+	sync.Mutex
+	byName map[string]GoldmarkExtension
+}{
+	byName: map[string]GoldmarkExtension{
+		"footnote":    {Extensions: []goldmark.Extender{extension.Footnote}},
+		"typographer": {Extensions: []goldmark.Extender{extension.Typographer}},
+		"cjk":         {Extensions: []goldmark.Extender{extension.CJK}},
+		"attribute":   {ParserOptions: []parser.Option{parser.WithAttribute()}},
+	},
+}
+
+// RegisterGoldmarkExtension makes ext available under name, so that config
+// files and the --goldmark-extension flag can enable it. Registering a name
+// again replaces the extension.
+func RegisterGoldmarkExtension(name string, ext GoldmarkExtension) {
+	goldmarkExtensions.Lock()
+	defer goldmarkExtensions.Unlock()
+	goldmarkExtensions.byName[name] = ext
+}
+
+// resolveGoldmarkExtensions returns the extensions enabled by name followed
+// by those added to Goldmark
+func (m *Markdown2Confluence) resolveGoldmarkExtensions() ([]GoldmarkExtension, error) {
+	goldmarkExtensions.Lock()
+	defer goldmarkExtensions.Unlock()
+
+	var extensions []GoldmarkExtension
+	for _, name := range m.GoldmarkExtensions {
+		ext, ok := goldmarkExtensions.byName[name]
+		if !ok {
+			var names []string
+			for name := range goldmarkExtensions.byName {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown goldmark extension %q, expected one of %s", name, strings.Join(names, ", "))
+		}
+		extensions = append(extensions, ext)
+	}
+	return append(extensions, m.Goldmark...), nil
+}
+
+// goldmarkOptions returns the goldmark options adding the extensions
+func goldmarkOptions(extensions []GoldmarkExtension) []goldmark.Option {
+	var options []goldmark.Option
+	for _, ext := range extensions {
+		if len(ext.Extensions) > 0 {
+			options = append(options, goldmark.WithExtensions(ext.Extensions...))
+		}
+		if len(ext.ParserOptions) > 0 {
+			options = append(options, goldmark.WithParserOptions(ext.ParserOptions...))
+		}
+		if len(ext.NodeRenderers) > 0 {
+			options = append(options, goldmark.WithRendererOptions(renderer.WithNodeRenderers(ext.NodeRenderers...)))
+		}
+	}
+	return options
+}
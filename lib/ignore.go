@@ -0,0 +1,334 @@
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// IgnoreFileName is the name of the files listing patterns of files and
+// directories to skip, with the semantics of .gitignore files
+const IgnoreFileName = ".markdown2confluenceignore"
+
+// skippedDirs are never searched for markdown files, just like hidden directories
+var skippedDirs = []string{"node_modules"}
+
+// pathPattern is a gitignore style glob. Patterns without a slash match at
+// any depth, patterns ending with a slash only match directories and
+// patterns starting with ! include what earlier patterns excluded.
+type pathPattern struct {
+	pattern string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// patternCache holds the compiled regular expressions and globs, so that
+// patterns are compiled once instead of for every path
+var patternCache = struct {
+	sync.Mutex
+	regexps map[string]*regexp.Regexp
+	globs   map[string]pathPattern
+}{
+	regexps: make(map[string]*regexp.Regexp),
+	globs:   make(map[string]pathPattern),
+}
+
+// compileRegexp returns the compiled regular expression
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	patternCache.Lock()
+	defer patternCache.Unlock()
+	if re, ok := patternCache.regexps[expr]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.regexps[expr] = re
+	return re, nil
+}
+
+// compilePattern returns the compiled gitignore style pattern
+func compilePattern(pattern string) (pathPattern, error) {
+	patternCache.Lock()
+	defer patternCache.Unlock()
+	if p, ok := patternCache.globs[pattern]; ok {
+		return p, nil
+	}
+
+	p := pathPattern{pattern: pattern}
+	glob := pattern
+	if strings.HasPrefix(glob, "!") {
+		p.negate, glob = true, glob[1:]
+	}
+	if strings.HasSuffix(glob, "/") {
+		p.dirOnly, glob = true, strings.TrimSuffix(glob, "/")
+	}
+	if glob == "" {
+		return p, fmt.Errorf("empty pattern")
+	}
+	if strings.Contains(glob, "/") {
+		glob = strings.TrimPrefix(glob, "/")
+	} else {
+		glob = "**/" + glob
+	}
+
+	expr, err := globRegexp(glob)
+	if err != nil {
+		return p, err
+	}
+	if p.re, err = regexp.Compile(expr); err != nil {
+		return p, err
+	}
+	patternCache.globs[pattern] = p
+	return p, nil
+}
+
+// globRegexp translates a glob into a regular expression. * and ? match
+// within a path segment and ** matches any number of directories.
+func globRegexp(glob string) (string, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			j := i + 1
+			if j < len(glob) && (glob[j] == '!' || glob[j] == '^') {
+				j++
+			}
+			if j < len(glob) && glob[j] == ']' {
+				j++
+			}
+			end := strings.IndexByte(glob[j:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : j+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i = j + end
+		case '\\':
+			if i+1 == len(glob) {
+				return "", fmt.Errorf("trailing backslash")
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String(), nil
+}
+
+// lastMatch returns the last pattern matching the slash separated relative
+// path rel, or nil
+func lastMatch(patterns []pathPattern, rel string, dir bool) *pathPattern {
+	var match *pathPattern
+	for i, p := range patterns {
+		if (!p.dirOnly || dir) && p.re.MatchString(rel) {
+			match = &patterns[i]
+		}
+	}
+	return match
+}
+
+// matchPatterns reports whether the last pattern matching rel includes it
+func matchPatterns(patterns []pathPattern, rel string, dir bool) bool {
+	match := lastMatch(patterns, rel, dir)
+	return match != nil && !match.negate
+}
+
+// compilePatterns compiles the patterns of a flag
+func compilePatterns(flag string, patterns []string) ([]pathPattern, error) {
+	var compiled []pathPattern
+	for _, pattern := range patterns {
+		p, err := compilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %s", flag, pattern, err)
+		}
+		compiled = append(compiled, p)
+	}
+	return compiled, nil
+}
+
+// validatePatterns reports the first invalid include or exclude pattern of
+// the flags and the config file
+func (m *Markdown2Confluence) validatePatterns() error {
+	if _, err := compilePatterns("--include", m.IncludePatterns); err != nil {
+		return err
+	}
+	if _, err := compilePatterns("--exclude-glob", m.ExcludePatterns); err != nil {
+		return err
+	}
+	for _, expr := range m.ExcludeFilePatterns {
+		if _, err := compileRegexp(expr); err != nil {
+			return fmt.Errorf("invalid --exclude pattern %q: %s", expr, err)
+		}
+	}
+	if m.config != nil {
+		return m.config.validatePatterns()
+	}
+	return nil
+}
+
+// validatePatterns reports the first invalid pattern of the directory overrides
+func (c *Config) validatePatterns() error {
+	for dir, override := range c.Directories {
+		if _, err := compilePatterns("exclude-glob", override.ExcludeGlob); err != nil {
+			return fmt.Errorf("%s in directory %s", err, dir)
+		}
+		for _, expr := range override.Exclude {
+			if _, err := compileRegexp(expr); err != nil {
+				return fmt.Errorf("invalid exclude pattern %q in directory %s: %s", expr, dir, err)
+			}
+		}
+		if err := override.validatePatterns(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceFilter decides which files of a source directory are published. It
+// collects the ignore files of the directories while they are walked.
+type sourceFilter struct {
+	root string
+	// ignores holds the patterns of the ignore files by directory relative to root
+	ignores map[string][]pathPattern
+}
+
+func newSourceFilter(root string) *sourceFilter {
+	return &sourceFilter{root: root, ignores: make(map[string][]pathPattern)}
+}
+
+// relative returns the slash separated path of p relative to the root
+func (s *sourceFilter) relative(p string) string {
+	rel, err := filepath.Rel(s.root, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// enterDir reads the ignore file of the directory p, if it has one
+func (s *sourceFilter) enterDir(p string) error {
+	f, err := os.Open(filepath.Join(p, IgnoreFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var patterns []pathPattern
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimRight(scanner.Text(), " \t\r")
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		compiled, err := compilePattern(pattern)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid pattern %q: %s", filepath.Join(p, IgnoreFileName), line, pattern, err)
+		}
+		patterns = append(patterns, compiled)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	s.ignores[s.relative(p)] = patterns
+	return nil
+}
+
+// ignored reports whether the ignore files of the root or any directory
+// above p exclude it. Patterns of deeper directories take precedence.
+func (s *sourceFilter) ignored(p string, dir bool) bool {
+	segments := strings.Split(s.relative(p), "/")
+	ignored := false
+	for i := range segments {
+		base := "."
+		if i > 0 {
+			base = strings.Join(segments[:i], "/")
+		}
+		if match := lastMatch(s.ignores[base], strings.Join(segments[i:], "/"), dir); match != nil {
+			ignored = !match.negate
+		}
+	}
+	return ignored
+}
+
+// skipDir reports whether the directory p is not searched for markdown files
+func (s *sourceFilter) skipDir(settings *Markdown2Confluence, p string, info os.FileInfo) bool {
+	if p == s.root {
+		return false
+	}
+	name := info.Name()
+	for _, skipped := range skippedDirs {
+		if name == skipped {
+			return true
+		}
+	}
+	if strings.HasPrefix(name, ".") || s.ignored(p, true) {
+		settings.debugf("skipping directory %s\n", p)
+		return true
+	}
+	excludes, _ := compilePatterns("--exclude-glob", settings.ExcludePatterns)
+	return matchPatterns(excludes, s.relative(p), true)
+}
+
+// skipFile reports whether the markdown file p is excluded by an ignore
+// file, the exclude patterns or the include patterns
+func (s *sourceFilter) skipFile(settings *Markdown2Confluence, p string) bool {
+	if s.ignored(p, false) {
+		settings.debugf("skipping %s: ignored by %s\n", p, IgnoreFileName)
+		return true
+	}
+
+	rel := s.relative(p)
+	excludes, _ := compilePatterns("--exclude-glob", settings.ExcludePatterns)
+	if match := lastMatch(excludes, rel, false); match != nil && !match.negate {
+		// sources are discovered repeatedly in watch mode, only report each file once
+		if !settings.excluded[p] {
+			settings.logf("excluding markdown file '%s': exclude glob '%s'\n", p, match.pattern)
+		}
+		if settings.excluded != nil {
+			settings.excluded[p] = true
+		}
+		return true
+	}
+	if settings.IsExcluded(p) {
+		return true
+	}
+
+	if len(settings.IncludePatterns) > 0 {
+		includes, _ := compilePatterns("--include", settings.IncludePatterns)
+		if !matchPatterns(includes, rel, false) {
+			settings.debugf("skipping %s: not included\n", p)
+			return true
+		}
+	}
+	return false
+}
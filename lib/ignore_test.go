@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		glob    string
+		want    string
+		wantErr bool
+	}{
+		{"*.md", `^[^/]*\.md$`, false},
+		{"doc?.md", `^doc[^/]\.md$`, false},
+		{"**/drafts", `^(?:.*/)?drafts$`, false},
+		{"docs/**", `^docs/.*$`, false},
+		{"[a-c]*.md", `^[a-c][^/]*\.md$`, false},
+		{"[!a]*", `^[^a][^/]*$`, false},
+		{`\*.md`, `^\*\.md$`, false},
+		{"a+b(1).md", `^a\+b\(1\)\.md$`, false},
+		{"[abc", "", true},
+		{`foo\`, "", true},
+	}
+	for _, test := range tests {
+		got, err := globRegexp(test.glob)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("globRegexp(%q) = %q, want an error", test.glob, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("globRegexp(%q) = %q, %v, want %q", test.glob, got, err, test.want)
+		}
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		rel      string
+		dir      bool
+		want     bool
+	}{
+		{[]string{"*.md"}, "a.md", false, true},
+		{[]string{"*.md"}, "guide/a.md", false, true},
+		{[]string{"/*.md"}, "guide/a.md", false, false},
+		{[]string{"/*.md"}, "a.md", false, true},
+		{[]string{"guide/*.md"}, "guide/a.md", false, true},
+		{[]string{"guide/*.md"}, "guide/deep/a.md", false, false},
+		{[]string{"guide/**/*.md"}, "guide/deep/a.md", false, true},
+		{[]string{"guide/**/*.md"}, "guide/a.md", false, true},
+		{[]string{"drafts/"}, "drafts", true, true},
+		{[]string{"drafts/"}, "drafts", false, false},
+		{[]string{"drafts/"}, "guide/drafts", true, true},
+		{[]string{"*.md", "!keep.md"}, "keep.md", false, false},
+		{[]string{"*.md", "!keep.md"}, "other.md", false, true},
+		{[]string{"!keep.md", "*.md"}, "keep.md", false, true},
+		{[]string{"README.md"}, "readme.md", false, false},
+	}
+	for _, test := range tests {
+		patterns, err := compilePatterns("--exclude-glob", test.patterns)
+		if err != nil {
+			t.Errorf("compilePatterns(%q): %s", test.patterns, err)
+			continue
+		}
+		if got := matchPatterns(patterns, test.rel, test.dir); got != test.want {
+			t.Errorf("matchPatterns(%q, %q, dir %t) = %t, want %t", test.patterns, test.rel, test.dir, got, test.want)
+		}
+	}
+
+	for _, pattern := range []string{"", "!", "/", "[a-"} {
+		if _, err := compilePatterns("--exclude-glob", []string{pattern}); err == nil {
+			t.Errorf("compilePatterns accepted the invalid pattern %q", pattern)
+		}
+	}
+}
+
+func TestSourceFilterIgnored(t *testing.T) {
+	root := t.TempDir()
+	ignores := map[string]string{
+		".":     "# generated\n*.gen.md\ndrafts/\nguide/secret.md\n",
+		"guide": "!keep.gen.md\nlocal.md\n",
+	}
+	for dir, content := range ignores {
+		p := filepath.Join(root, dir)
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(p, IgnoreFileName), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter := newSourceFilter(root)
+	for _, dir := range []string{root, filepath.Join(root, "guide")} {
+		if err := filter.enterDir(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		dir  bool
+		want bool
+	}{
+		{"a.md", false, false},
+		{"a.gen.md", false, true},
+		{"guide/b.gen.md", false, true},
+		{"guide/keep.gen.md", false, false},
+		{"guide/secret.md", false, true},
+		{"guide/local.md", false, true},
+		{"local.md", false, false},
+		{"drafts", true, true},
+		{"drafts", false, false},
+		{"guide/drafts", true, true},
+	}
+	for _, test := range tests {
+		p := filepath.Join(root, filepath.FromSlash(test.path))
+		if got := filter.ignored(p, test.dir); got != test.want {
+			t.Errorf("ignored(%q, dir %t) = %t, want %t", test.path, test.dir, got, test.want)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "guide", IgnoreFileName), []byte("ok.md\n[bad\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newSourceFilter(root).enterDir(filepath.Join(root, "guide")); err == nil {
+		t.Errorf("enterDir accepted an invalid pattern")
+	}
+}
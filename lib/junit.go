@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the published files of a space
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is a published file. Unchanged pages are skipped.
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes the results as JUnit XML report to p, with a test suite
+// per space and a test case per markdown file
+func (m *Markdown2Confluence) writeJUnit(p string, results []UploadResult, now time.Time) error {
+	report := junitTestSuites{Name: "markdown2confluence"}
+	suites := make(map[string]int)
+	durations := make(map[int]time.Duration)
+	var total time.Duration
+
+	for _, r := range results {
+		space := r.File.pageSettings(m).Space
+		i, ok := suites[space]
+		if !ok {
+			i = len(report.Suites)
+			suites[space] = i
+			report.Suites = append(report.Suites, junitTestSuite{
+				Name:      space,
+				Timestamp: now.Format("2006-01-02T15:04:05"),
+			})
+		}
+		suite := &report.Suites[i]
+
+		testCase := junitTestCase{
+			Name:      r.File.Path,
+			ClassName: space + "." + r.File.Title,
+			Time:      junitSeconds(r.Duration),
+		}
+		if r.WebURL != "" {
+			testCase.SystemOut = fmt.Sprintf("%s %s", r.Action, r.WebURL)
+		}
+		switch {
+		case r.Err != nil:
+			testCase.Failure = &junitMessage{Message: fmt.Sprintf("Unable to upload markdown file %s", r.File.Path), Text: r.Err.Error()}
+			suite.Failures++
+			report.Failures++
+		case r.Action == ActionUnchanged:
+			testCase.Skipped = &junitMessage{Message: "page is unchanged"}
+			suite.Skipped++
+			report.Skipped++
+		}
+
+		suite.Cases = append(suite.Cases, testCase)
+		suite.Tests++
+		report.Tests++
+		durations[i] += r.Duration
+		total += r.Duration
+	}
+
+	for i := range report.Suites {
+		report.Suites[i].Time = junitSeconds(durations[i])
+	}
+	report.Time = junitSeconds(total)
+
+	dat, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p, append([]byte(xml.Header), append(dat, '\n')...), 0644); err != nil {
+		return fmt.Errorf("Unable to write JUnit report %s: %s", p, err)
+	}
+	return nil
+}
+
+// junitSeconds formats a duration in seconds as used by JUnit reports
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
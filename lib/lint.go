@@ -0,0 +1,330 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/justmiles/go-confluence"
+	"github.com/justmiles/go-markdown2confluence/lib/renderer"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+// MaxTitleLength is the longest page title Confluence accepts
+const MaxTitleLength = 255
+
+// LintProblem is a problem found in a markdown file. Line is 0 if the
+// problem concerns the whole file.
+type LintProblem struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (p LintProblem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.Path, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", p.Path, p.Line, p.Message)
+}
+
+// Lint checks the markdown files of all sources for missing images, broken
+// links to other markdown files, invalid page titles and malformed
+// CONFLUENCE-MACRO blocks. Duplicate titles are found among the pages of the
+// run and, if the connection settings are complete, among the pages of the
+// space outside of the published tree.
+func (m *Markdown2Confluence) Lint() ([]LintProblem, error) {
+	if err := m.prepare(); err != nil {
+		return nil, err
+	}
+
+	// duplicate titles are reported as problems unless they are disambiguated
+	markdownFiles, err := m.discoverSources(time.Now())
+	if err == nil && m.TitleStrategy != "" && m.TitleStrategy != TitleStrategyFail {
+		markdownFiles, err = m.disambiguateTitles(markdownFiles)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []LintProblem
+	for _, markdownFile := range markdownFiles {
+		fileProblems, err := m.lintFile(markdownFile.Path)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, fileProblems...)
+	}
+	problems = append(problems, m.lintTitles(markdownFiles)...)
+	if m.ValidateConnection() != nil {
+		return problems, nil
+	}
+	spaceProblems, err := m.lintSpaceTitles(markdownFiles)
+	if err != nil {
+		return nil, err
+	}
+	return append(problems, spaceProblems...), nil
+}
+
+// lintSpaceTitles reports pages of the space that have the title of a page or
+// folder page to publish but are outside of the published tree, which
+// publishing would reject unless the title strategy disambiguates the title
+func (m *Markdown2Confluence) lintSpaceTitles(markdownFiles []MarkdownFile) ([]LintProblem, error) {
+	var problems []LintProblem
+	// roots maps the topmost parents to their page ids, empty if they do not exist yet
+	roots := make(map[string]string)
+	checked := make(map[string]bool)
+	for _, markdownFile := range markdownFiles {
+		space := markdownFile.pageSettings(m).Space
+		parents := deleteEmpty(markdownFile.Parents)
+
+		root, newTree := markdownFile.root, false
+		if root == "" && len(parents) > 0 {
+			key := parentIndexKey(space, nil, parents[0])
+			id, ok := roots[key]
+			if !ok {
+				content, err := m.findPage(space, parents[0])
+				if err != nil {
+					return nil, err
+				}
+				id = content.ID
+				roots[key] = id
+			}
+			root, newTree = id, id == ""
+		} else if root == "" {
+			root = markdownFile.Ancestor
+		}
+
+		// folder pages are reused if they exist in the tree, like by FindOrCreateAncestors
+		var path []string
+		for i, parent := range parents {
+			key := parentIndexKey(space, path, parent)
+			if !checked[key] {
+				checked[key] = true
+				folderRoot := root
+				if i == 0 {
+					folderRoot = ""
+				}
+				msg, err := m.lintSpaceTitle(space, path, parent, folderRoot, newTree && i > 0, false)
+				if err != nil {
+					return nil, err
+				}
+				if msg != "" {
+					problems = append(problems, LintProblem{Path: markdownFile.Path, Message: msg})
+				}
+			}
+			path = append(path, parent)
+		}
+
+		msg, err := m.lintSpaceTitle(space, parents, markdownFile.Title, root, newTree, root == "")
+		if err != nil {
+			return nil, err
+		}
+		if msg != "" {
+			problems = append(problems, LintProblem{Path: markdownFile.Path, Message: msg})
+		}
+	}
+	return problems, nil
+}
+
+// lintSpaceTitle returns the collision publishing a page titled title below
+// path would run into, or an empty string. Every existing page is outside of
+// a tree that does not exist yet, and pages at the top of the space must be
+// recorded in the state file if it records any.
+func (m *Markdown2Confluence) lintSpaceTitle(space string, path []string, title, root string, newTree, top bool) (string, error) {
+	for renamed := false; ; renamed = true {
+		content, err := m.findPage(space, title)
+		if err != nil {
+			return "", err
+		}
+		if content.ID == "" {
+			return "", nil
+		}
+		if !newTree && !outsideTree(content, root) && (!top || m.publishedBefore(content.ID)) {
+			return "", nil
+		}
+
+		disambiguated := strategyTitle(m.TitleStrategy, path, title)
+		if renamed || m.TitleStrategy == "" || m.TitleStrategy == TitleStrategyFail || disambiguated == title {
+			return titleCollision(title, content).Error(), nil
+		}
+		title = disambiguated
+	}
+}
+
+// findPage returns the page of the space with the title and its ancestors,
+// or an empty page if there is none
+func (m *Markdown2Confluence) findPage(space, title string) (confluence.Content, error) {
+	contentResults, err := m.Client.GetContent(&confluence.GetContentQueryParameters{
+		Title:    title,
+		Spacekey: space,
+		Limit:    1,
+		Type:     "page",
+		Expand:   []string{"ancestors"},
+	})
+	if err != nil {
+		return confluence.Content{}, fmt.Errorf("Error checking for existing page %s: %s", title, err)
+	}
+	if len(contentResults) == 0 {
+		return confluence.Content{}, nil
+	}
+	return contentResults[0], nil
+}
+
+// lintTitles reports titles Confluence rejects and titles used by more than
+// one page of a space, including the folder pages that would be created
+func (m *Markdown2Confluence) lintTitles(markdownFiles []MarkdownFile) []LintProblem {
+	var problems []LintProblem
+	// owners maps space and title to the file or folder publishing the page
+	owners := make(map[string]string)
+	claim := func(space, title, owner, p string) {
+		titleKey := space + ":" + title
+		if other, ok := owners[titleKey]; ok && other != owner {
+			problems = append(problems, LintProblem{Path: p, Message: fmt.Sprintf("page title %q is also used by %s", title, other)})
+			return
+		}
+		owners[titleKey] = owner
+	}
+
+	for _, markdownFile := range markdownFiles {
+		space := markdownFile.pageSettings(m).Space
+
+		var path []string
+		for _, parent := range deleteEmpty(markdownFile.Parents) {
+			key := parentIndexKey(space, path, parent)
+			owner := "folder " + strings.Join(append(append([]string{}, path...), parent), "/")
+			if indexPath, ok := m.folderIndexes[key]; ok {
+				owner = indexPath
+			}
+			claim(space, parent, owner, markdownFile.Path)
+			path = append(path, parent)
+		}
+
+		switch length := utf8.RuneCountInString(markdownFile.Title); {
+		case strings.TrimSpace(markdownFile.Title) == "":
+			problems = append(problems, LintProblem{Path: markdownFile.Path, Message: "page title is empty"})
+		case length > MaxTitleLength:
+			problems = append(problems, LintProblem{Path: markdownFile.Path, Message: fmt.Sprintf("page title is %d characters long, Confluence allows at most %d", length, MaxTitleLength)})
+		}
+		claim(space, markdownFile.Title, markdownFile.Path, markdownFile.Path)
+	}
+	return problems
+}
+
+// lintFile checks the images, links and macros of the markdown file at p
+func (m *Markdown2Confluence) lintFile(p string) ([]LintProblem, error) {
+	source, err := m.readMarkdown(p)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open file %s:\n\t%s", p, err)
+	}
+	// front matter is not published, blank lines in its place keep the line numbers
+	if _, body := splitFrontMatter(source); len(body) != len(source) {
+		lines := bytes.Count(bytes.ReplaceAll(source, []byte("\r\n"), []byte("\n")), []byte("\n")) - bytes.Count(body, []byte("\n"))
+		source = append(bytes.Repeat([]byte("\n"), lines), body...)
+	}
+
+	md := goldmark.New(goldmark.WithExtensions(extension.GFM, extension.DefinitionList))
+	doc := md.Parser().Parse(text.NewReader(source))
+
+	var problems []LintProblem
+	report := func(line int, format string, args ...interface{}) {
+		problems = append(problems, LintProblem{Path: p, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	err = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node := n.(type) {
+		case *ast.Image:
+			destination := string(node.Destination)
+			if localDestination(p, destination) != "" && !strings.HasPrefix(destination, "data:") {
+				if _, err := renderer.LocalFile(p, node.Destination); err != nil {
+					report(nodeLine(source, n, node.Destination), "image %s does not exist", destination)
+				}
+			}
+		case *ast.Link:
+			destination := string(node.Destination)
+			if target := localDestination(p, destination); target != "" && m.isMarkdown(target) {
+				if _, err := os.Stat(target); err != nil {
+					report(nodeLine(source, n, node.Destination), "link to %s: markdown file does not exist", destination)
+				}
+			}
+		case *ast.FencedCodeBlock:
+			if string(node.Language(source)) == renderer.LanguageStringConfluenceMacro {
+				for _, problem := range lintMacro(source, node) {
+					report(problem.Line, "%s", problem.Message)
+				}
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return problems, err
+}
+
+// lintMacro checks that a CONFLUENCE-MACRO block can be turned into a macro:
+// every line is a key: value pair and the macro has a name
+func lintMacro(source []byte, n *ast.FencedCodeBlock) []LintProblem {
+	var problems []LintProblem
+	hasName := false
+	for i := 0; i < n.Lines().Len(); i++ {
+		segment := n.Lines().At(i)
+		text := strings.TrimRight(string(segment.Value(source)), "\r\n")
+		line := lineAt(source, segment.Start)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, ":")
+		switch {
+		case !ok:
+			problems = append(problems, LintProblem{Line: line, Message: fmt.Sprintf("CONFLUENCE-MACRO line %q is not a key: value pair", strings.TrimSpace(text))})
+		case strings.TrimSpace(key) == "":
+			problems = append(problems, LintProblem{Line: line, Message: "CONFLUENCE-MACRO line has an empty key"})
+		case strings.TrimSpace(key) == "name" && key[0] != ' ' && key[0] != '\t':
+			if strings.TrimSpace(value) == "" {
+				problems = append(problems, LintProblem{Line: line, Message: "CONFLUENCE-MACRO name is empty"})
+			}
+			hasName = true
+		}
+	}
+	if !hasName {
+		problems = append(problems, LintProblem{Line: lineAt(source, n.Info.Segment.Start), Message: "CONFLUENCE-MACRO block has no name"})
+	}
+	return problems
+}
+
+// nodeLine returns the line of an inline node, using its first text segment
+// or the position of its destination in the enclosing block
+func nodeLine(source []byte, n ast.Node, destination []byte) int {
+	for c := n.FirstChild(); c != nil; c = c.FirstChild() {
+		if t, ok := c.(*ast.Text); ok {
+			return lineAt(source, t.Segment.Start)
+		}
+	}
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if p.Type() == ast.TypeBlock && p.Lines().Len() > 0 {
+			start, stop := p.Lines().At(0).Start, p.Lines().At(p.Lines().Len()-1).Stop
+			if i := bytes.Index(source[start:stop], destination); i >= 0 {
+				return lineAt(source, start+i)
+			}
+			return lineAt(source, start)
+		}
+	}
+	return 0
+}
+
+// lineAt returns the line number of a byte offset in source
+func lineAt(source []byte, offset int) int {
+	if offset > len(source) {
+		offset = len(source)
+	}
+	return bytes.Count(source[:offset], []byte("\n")) + 1
+}
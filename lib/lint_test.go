@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/justmiles/go-confluence"
+)
+
+// spaceClient finds the pages of a space by title. The ancestors of a page
+// are given as ids.
+type spaceClient struct {
+	Client
+	pages map[string][]string
+	ids   map[string]string
+}
+
+func (c *spaceClient) GetContent(qp *confluence.GetContentQueryParameters) ([]confluence.Content, error) {
+	ancestors, ok := c.pages[qp.Title]
+	if !ok {
+		return nil, nil
+	}
+	content := confluence.Content{ID: c.ids[qp.Title], Title: qp.Title}
+	content.Ancestors = make([]struct {
+		ID string `json:"id,omitempty"`
+	}, len(ancestors))
+	for i, id := range ancestors {
+		content.Ancestors[i].ID = id
+	}
+	return []confluence.Content{content}, nil
+}
+
+func TestLintSpaceTitles(t *testing.T) {
+	client := &spaceClient{
+		pages: map[string][]string{
+			"Docs":      nil,
+			"Guide":     {"1"},
+			"Setup":     {"1", "2"},
+			"Overview":  {"9"},
+			"Elsewhere": {"9"},
+			"Home":      nil,
+			"Notes":     nil,
+		},
+		ids: map[string]string{"Docs": "1", "Guide": "2", "Setup": "3", "Overview": "4", "Elsewhere": "5", "Home": "6", "Notes": "7"},
+	}
+	files := []MarkdownFile{
+		{Path: "docs/guide/setup.md", Title: "Setup", Parents: []string{"Docs", "Guide"}},
+		{Path: "docs/overview.md", Title: "Overview", Parents: []string{"Docs"}},
+		{Path: "home.md", Title: "Home"},
+		{Path: "elsewhere.md", Title: "Elsewhere"},
+		{Path: "new/notes.md", Title: "Notes", Parents: []string{"New"}},
+	}
+
+	tests := []struct {
+		name     string
+		strategy string
+		state    map[string]PublishedPage
+		want     []string
+	}{
+		{"fail", "", nil, []string{"docs/overview.md", "elsewhere.md", "new/notes.md"}},
+		{"disambiguated below parents", TitleStrategyParent, nil, []string{"elsewhere.md"}},
+		{"top level page unknown to the state", "", map[string]PublishedPage{"5": {Version: 1}}, []string{"docs/overview.md", "home.md", "elsewhere.md", "new/notes.md"}},
+	}
+	for _, test := range tests {
+		m := &Markdown2Confluence{Client: client, TitleStrategy: test.strategy}
+		if test.state != nil {
+			m.state = &State{Pages: test.state}
+		}
+		problems, err := m.lintSpaceTitles(append([]MarkdownFile{}, files...))
+		if err != nil {
+			t.Errorf("%s: lintSpaceTitles error = %v", test.name, err)
+			continue
+		}
+		var paths []string
+		for _, problem := range problems {
+			paths = append(paths, problem.Path)
+		}
+		if !reflect.DeepEqual(paths, test.want) {
+			t.Errorf("%s: problems in %v, want %v", test.name, paths, test.want)
+		}
+	}
+}
@@ -2,18 +2,20 @@ package lib
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
-	"github.com/justmiles/go-confluence"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
@@ -26,8 +28,9 @@ const (
 	// DefaultEndpoint provides an example endpoint for users
 	DefaultEndpoint = "https://mydomain.atlassian.net/wiki"
 
-	// Parallelism determines how many files to convert and upload at a time
-	Parallelism = 5
+	// DefaultParallelism determines how many files to convert and upload at a time
+	// unless configured otherwise
+	DefaultParallelism = 5
 )
 
 // Markdown2Confluence stores the settings for each run
@@ -41,6 +44,7 @@ type Markdown2Confluence struct {
 	UseDocumentTitle    bool
 	WithHardWraps       bool
 	Since               int
+	ChangedSince        string
 	Username            string
 	Password            string
 	AccessToken         string
@@ -48,18 +52,127 @@ type Markdown2Confluence struct {
 	Endpoint            string
 	Parent              string
 	SourceMarkdown      []string
+	Mappings            []SourceMapping
 	ExcludeFilePatterns []string
-	client              *confluence.Client
+	ExcludePatterns     []string
+	IncludePatterns     []string
+	Extensions          []string
+	Output              string
+	ReportFile          string
+	JUnitFile           string
+	Labels              []string
+	FolderTemplate      string
+	FolderSort          string
+	FolderDepth         int
+	Parallelism         int
+	RetryAttempts       int
+	RetryMaxWait        time.Duration
+	GitComment          bool
+	GitFooter           bool
+	RepoURLTemplate     string
+	StateFile           string
+	OnConflict          string
+	TitleStrategy       string
+	TitleTemplate       string
+	HumanizeTitles      bool
+	TitlePrefix         string
+	TitleSuffix         string
+	OrderPages          bool
+	Nav                 bool
+	GoldmarkExtensions  []string
+
+	// Goldmark adds syntax and node renderers to the conversion into storage
+	// format, after the extensions enabled by GoldmarkExtensions.
+	Goldmark []GoldmarkExtension
+	// Client publishes the pages. Defaults to a client for Endpoint using the
+	// configured credentials.
+	Client Client
+	// Logger receives progress and debug messages. Defaults to standard output.
+	Logger Logger
+	// Stdout receives the reports, diffs and rendered pages. Defaults to
+	// standard output.
+	Stdout io.Writer
+	// OnEvent is called for every page rendered, created and updated and every
+	// attachment uploaded. It is called from several goroutines at once.
+	OnEvent func(Event)
+
+	parents       *parentIndex
+	folderIndexes map[string]string
+	// indexSettings holds the settings of the folder index files by path,
+	// which depend on the source or mapping they were discovered from
+	indexSettings   map[string]*Markdown2Confluence
+	state           *State
+	repoURLTemplate *template.Template
+	titleTemplate   *template.Template
+	config          *Config
+	configured      func(key string) bool
+	excluded        map[string]bool
+	goldmark        []GoldmarkExtension
+	// stdin holds the document read from standard input
+	stdin *stdinSource
+}
+
+// SourceMapping publishes a markdown file or directory into its own space,
+// optionally under a parent page
+type SourceMapping struct {
+	Source string `yaml:"source"`
+	Space  string `yaml:"space"`
+	Parent string `yaml:"parent"`
+}
+
+// ParseSourceMapping parses a mapping in the form source=SPACE or
+// source=SPACE/Parent/Page. The parent of a single file may also be a page id.
+func ParseSourceMapping(s string) (SourceMapping, error) {
+	source, target, ok := strings.Cut(s, "=")
+	if !ok || source == "" || target == "" {
+		return SourceMapping{}, fmt.Errorf("invalid mapping %q, expected source=SPACE[/parent]", s)
+	}
+	space, parent, _ := strings.Cut(target, "/")
+	return SourceMapping{
+		Source: source,
+		Space:  space,
+		Parent: parent,
+	}, nil
 }
 
 // CreateClient returns a new markdown client
 func (m *Markdown2Confluence) CreateClient() {
-	m.client = new(confluence.Client)
-	m.client.Username = m.Username
-	m.client.Password = m.Password
-	m.client.AccessToken = m.AccessToken
-	m.client.Endpoint = m.Endpoint
-	m.client.Debug = m.Debug
+	// the transport is owned by the run, so that neither retries nor the TLS
+	// settings change other HTTP clients of the process
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if m.InsecureTLS {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	httpClient := &http.Client{
+		Transport: &retryTransport{
+			Attempts: m.retryAttempts(),
+			MaxWait:  m.RetryMaxWait,
+			Debug:    m.Debug,
+			Logger:   m.logger(),
+			Next:     transport,
+		},
+	}
+
+	client := &ConfluenceClient{
+		Endpoint:    m.Endpoint,
+		Username:    m.Username,
+		Password:    m.Password,
+		AccessToken: m.AccessToken,
+		HTTPClient:  httpClient,
+	}
+	if m.Debug {
+		client.Logger = m.logger()
+	}
+	m.Client = client
+}
+
+// retryAttempts returns how often an API call is attempted, DefaultRetryAttempts
+// unless RetryAttempts is set
+func (m *Markdown2Confluence) retryAttempts() int {
+	if m.RetryAttempts < 1 {
+		return DefaultRetryAttempts
+	}
+	return m.RetryAttempts
 }
 
 // SourceEnvironmentVariables overrides Markdown2Confluence with any environment variables that are set
@@ -91,9 +204,59 @@ func (m *Markdown2Confluence) SourceEnvironmentVariables() {
 
 // Validate required configs are set
 func (m Markdown2Confluence) Validate() error {
-	if m.Space == "" {
+	if m.Space == "" && (len(m.SourceMarkdown) > 0 || len(m.Mappings) == 0) {
 		return fmt.Errorf("--space is not defined")
 	}
+	if err := m.ValidateConnection(); err != nil {
+		return err
+	}
+	if err := m.validateSources(); err != nil {
+		return err
+	}
+	if m.AccessToken == "" && m.Username == "" {
+		return fmt.Errorf("--access-token is not defined")
+	}
+	switch m.OnConflict {
+	case "", ConflictFail, ConflictWarn, ConflictOverwrite:
+	default:
+		return fmt.Errorf("--on-conflict must be one of %s, %s or %s", ConflictFail, ConflictWarn, ConflictOverwrite)
+	}
+	switch m.Output {
+	case "", OutputText, OutputJSON:
+	default:
+		return fmt.Errorf("--output must be %s or %s", OutputText, OutputJSON)
+	}
+	switch m.TitleStrategy {
+	case "", TitleStrategyFail, TitleStrategyParent, TitleStrategyPath:
+	default:
+		return fmt.Errorf("--title-strategy must be one of %s, %s or %s", TitleStrategyFail, TitleStrategyParent, TitleStrategyPath)
+	}
+	return nil
+}
+
+// validateSources checks the markdown sources and mappings
+func (m Markdown2Confluence) validateSources() error {
+	if len(m.SourceMarkdown) == 0 && len(m.Mappings) == 0 {
+		return fmt.Errorf("please pass a markdown file or directory of markdown files")
+	}
+	if len(m.SourceMarkdown)+len(m.Mappings) > 1 && m.Title != "" {
+		return fmt.Errorf("You can not set the title for multiple files")
+	}
+	for _, source := range m.SourceMarkdown {
+		if source == Stdin && m.Title == "" {
+			return fmt.Errorf("--title is required when reading from stdin")
+		}
+	}
+	for _, mapping := range m.Mappings {
+		if mapping.Source == "" || mapping.Space == "" {
+			return fmt.Errorf("mapping %s=%s needs both a source and a space", mapping.Source, mapping.Space)
+		}
+	}
+	return nil
+}
+
+// ValidateConnection checks the settings needed to connect to Confluence
+func (m Markdown2Confluence) ValidateConnection() error {
 	if m.Username == "" && m.AccessToken == "" {
 		return fmt.Errorf("--username is not defined")
 	}
@@ -106,23 +269,22 @@ func (m Markdown2Confluence) Validate() error {
 	if m.Endpoint == DefaultEndpoint {
 		return fmt.Errorf("--endpoint is not defined")
 	}
-	if len(m.SourceMarkdown) == 0 {
-		return fmt.Errorf("please pass a markdown file or directory of markdown files")
-	}
-	if len(m.SourceMarkdown) > 1 && m.Title != "" {
-		return fmt.Errorf("You can not set the title for multiple files")
-	}
-	if m.AccessToken == "" && m.Username == "" {
-		return fmt.Errorf("--access-token is not defined")
-	}
 	return nil
 }
 
+// IsExcluded reports whether the path matches one of the exclude regular
+// expressions. Invalid expressions are reported by prepare.
 func (m *Markdown2Confluence) IsExcluded(p string) bool {
 	for _, pattern := range m.ExcludeFilePatterns {
-		r := regexp.MustCompile(pattern)
-		if r.MatchString(p) {
-			fmt.Printf("excluding markdown file '%s': exclude pattern '%s'\n", p, pattern)
+		r, err := compileRegexp(pattern)
+		if err == nil && r.MatchString(p) {
+			// sources are discovered repeatedly in watch mode, only report each file once
+			if !m.excluded[p] {
+				m.logf("excluding markdown file '%s': exclude pattern '%s'\n", p, pattern)
+			}
+			if m.excluded != nil {
+				m.excluded[p] = true
+			}
 			return true
 		}
 	}
@@ -132,176 +294,475 @@ func (m *Markdown2Confluence) IsExcluded(p string) bool {
 
 // Run the sync
 func (m *Markdown2Confluence) Run() []error {
-	var markdownFiles []MarkdownFile
-	var now = time.Now()
-	m.CreateClient()
+	results, err := m.Publish(context.Background())
 
-	for _, f := range m.SourceMarkdown {
-		file, err := os.Open(f)
-		defer file.Close()
-		if err != nil {
-			return []error{fmt.Errorf("Error opening file %s", err)}
-		}
-
-		stat, err := file.Stat()
-		if err != nil {
-			return []error{fmt.Errorf("Error reading file meta %s", err)}
-		}
+	errors := uploadErrors(results)
+	if runErrors, ok := err.(Errors); ok {
+		errors = append(errors, runErrors...)
+	} else if err != nil {
+		errors = append(errors, err)
+	}
+	if err := m.report(results, err); err != nil {
+		errors = append(errors, err)
+	}
+	return errors
+}
 
-		var md MarkdownFile
+// Publish uploads the markdown files of all sources and mappings and returns
+// the result of every file, in the order they were discovered. Failed uploads
+// are reported in their result, the returned error holds the failures of the
+// run itself. Files not yet published when ctx is done fail with its error.
+func (m *Markdown2Confluence) Publish(ctx context.Context) ([]UploadResult, error) {
+	if err := m.prepare(); err != nil {
+		return nil, err
+	}
 
-		if stat.IsDir() {
+	// requests of the built in client end when ctx is done
+	if client, ok := m.Client.(*ConfluenceClient); ok {
+		m.Client = client.WithContext(ctx)
+		defer func() { m.Client = client }()
+	}
 
-			// prevent someone from accidently uploading everything under the same title
-			if m.Title != "" {
-				return []error{fmt.Errorf("--title not supported for directories")}
-			}
+	markdownFiles, err := m.discoverAll(time.Now())
+	if err != nil {
+		return nil, err
+	}
 
-			err := filepath.Walk(f,
-				func(path string, info os.FileInfo, err error) error {
-					if err != nil {
-						return err
-					}
+	// Only include files that changed since m.ChangedSince, or depend on files that did
+	if m.ChangedSince != "" {
+		markdownFiles, err = m.filterChanged(markdownFiles)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-					if strings.HasSuffix(path, ".md") && !m.IsExcluded(path) {
+	results := m.publishAll(ctx, markdownFiles)
+	var errors Errors
+	if err := m.saveState(); err != nil {
+		errors = append(errors, err)
+	}
+	if (m.OrderPages || m.Nav) && ctx.Err() == nil {
+		errors = append(errors, m.orderPages(markdownFiles, results)...)
+	}
+	if len(errors) > 0 {
+		return results, errors
+	}
+	return results, nil
+}
 
-						// Only include this file if it was modified m.Since minutes ago
-						if m.Since != 0 {
-							if info.ModTime().Unix() < now.Add(time.Duration(m.Since*-1)*time.Minute).Unix() {
-								if m.Debug {
-									fmt.Printf("skipping %s: last modified %s\n", info.Name(), info.ModTime())
-								}
-								return nil
-							}
-						}
+// Errors holds several errors of a run
+type Errors []error
 
-						var tempTitle string
-						var tempParents []string
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
 
-						if strings.HasSuffix(path, "README.md") {
-							tempTitle = strings.Split(path, "/")[len(strings.Split(path, "/"))-2]
-							tempParents = deleteFromSlice(deleteFromSlice(strings.Split(filepath.Dir(strings.TrimPrefix(filepath.ToSlash(path), filepath.ToSlash(f))), "/"), "."), tempTitle)
-						} else {
-							tempTitle = strings.TrimSuffix(filepath.Base(path), ".md")
-							tempParents = deleteFromSlice(strings.Split(filepath.Dir(strings.TrimPrefix(filepath.ToSlash(path), filepath.ToSlash(f))), "/"), ".")
-						}
+// prepare sets up the client and the state shared by all uploads of a run
+func (m *Markdown2Confluence) prepare() error {
+	if m.Client == nil {
+		m.CreateClient()
+	}
+	if m.stdin == nil {
+		m.stdin = &stdinSource{}
+	}
+	m.parents = newParentIndex()
+	m.excluded = make(map[string]bool)
 
-						if m.UseDocumentTitle == true {
-							doc_title := getDocumentTitle(path)
-							if doc_title != "" {
-								tempTitle = doc_title
-							}
-						}
+	if err := m.validatePatterns(); err != nil {
+		return err
+	}
 
-						md = MarkdownFile{
-							Path:    path,
-							Parents: tempParents,
-							Title:   tempTitle,
-						}
+	extensions, err := m.resolveGoldmarkExtensions()
+	if err != nil {
+		return err
+	}
+	m.goldmark = extensions
 
-						if m.Parent != "" {
-							parents := strings.Split(m.Parent, "/")
-							md.Parents = append(parents, md.Parents...)
-							md.Parents = deleteEmpty(md.Parents)
-						}
+	if m.RepoURLTemplate != "" {
+		t, err := template.New("repo-url").Parse(m.RepoURLTemplate)
+		if err != nil {
+			return fmt.Errorf("Unable to parse --repo-url template: %s", err)
+		}
+		m.repoURLTemplate = t
+	}
 
-						markdownFiles = append(markdownFiles, md)
+	if m.TitleTemplate != "" {
+		t, err := template.New("title").Parse(m.TitleTemplate)
+		if err != nil {
+			return fmt.Errorf("Unable to parse --title-template: %s", err)
+		}
+		m.titleTemplate = t
+	}
 
-					}
-					return nil
-				})
-			if err != nil {
-				return []error{fmt.Errorf("Unable to walk path: %s", f)}
-			}
+	if m.StateFile != "" {
+		state, err := LoadState(m.StateFile)
+		if err != nil {
+			return err
+		}
+		m.state = state
+	}
+	return nil
+}
 
-		} else {
-			md = MarkdownFile{
-				Path:  f,
-				Title: m.Title,
-			}
+// discoverAll returns the markdown files of all sources and mappings, with
+// titles that are unique within their space
+func (m *Markdown2Confluence) discoverAll(now time.Time) ([]MarkdownFile, error) {
+	markdownFiles, err := m.discoverSources(now)
+	if err != nil {
+		return nil, err
+	}
+	return m.disambiguateTitles(markdownFiles)
+}
 
-			if md.Title == "" {
-				if m.UseDocumentTitle == true {
-					md.Title = getDocumentTitle(f)
-				}
-				if md.Title == "" {
-					md.Title = strings.TrimSuffix(filepath.Base(f), ".md")
-				}
-			}
+// discoverSources returns the markdown files of all sources and mappings. It
+// finds the folder index files again, so that deleted ones are forgotten when
+// watching the sources.
+func (m *Markdown2Confluence) discoverSources(now time.Time) ([]MarkdownFile, error) {
+	var markdownFiles []MarkdownFile
+	m.folderIndexes = make(map[string]string)
+	m.indexSettings = make(map[string]*Markdown2Confluence)
 
-			if m.Parent != "" {
-				// If parent was passed as page id
-				id, _ := strconv.Atoi(m.Parent)
-				if id != 0 {
-					md.Ancestor = fmt.Sprintf("%d", id)
-				} else {
-					// Otherwise split parents
-					parents := strings.Split(m.Parent, "/")
-					md.Parents = append(parents, md.Parents...)
-					md.Parents = deleteEmpty(md.Parents)
-				}
-			}
+	var sources []string
+	var bases []*Markdown2Confluence
+	for _, f := range m.SourceMarkdown {
+		sources = append(sources, f)
+		bases = append(bases, m)
+	}
+	for _, mapping := range m.Mappings {
+		base := *m
+		base.Space = mapping.Space
+		base.Parent = mapping.Parent
+		sources = append(sources, mapping.Source)
+		bases = append(bases, &base)
+	}
 
-			markdownFiles = append(markdownFiles, md)
+	for i, f := range sources {
+		files, err := m.discover(f, bases[i], now)
+		if err != nil {
+			return nil, err
 		}
+		markdownFiles = append(markdownFiles, files...)
+	}
+	return markdownFiles, nil
+}
 
+// publishAll uploads the markdown files with the worker pool and returns
+// their results in the same order
+func (m *Markdown2Confluence) publishAll(ctx context.Context, markdownFiles []MarkdownFile) []UploadResult {
+	parallelism := m.Parallelism
+	if parallelism < 1 {
+		parallelism = DefaultParallelism
 	}
 
 	var (
-		wg    = sync.WaitGroup{}
-		queue = make(chan MarkdownFile)
+		wg      = sync.WaitGroup{}
+		queue   = make(chan int)
+		results = make([]UploadResult, len(markdownFiles))
 	)
 
-	var errors []error
-
-	// Process the queue
-	for worker := 0; worker < Parallelism; worker++ {
+	// Process the queue. Every worker writes the results of the files it
+	// receives into their own slot, so no further synchronization is needed.
+	for worker := 0; worker < parallelism; worker++ {
 		wg.Add(1)
-		go m.queueProcessor(&wg, &queue, &errors)
+		go m.queueProcessor(ctx, &wg, queue, markdownFiles, results)
 	}
 
-	for _, markdownFile := range markdownFiles {
+	for i, markdownFile := range markdownFiles {
+		start := time.Now()
+		if err := ctx.Err(); err != nil {
+			results[i] = UploadResult{File: markdownFile, Action: ActionFailed, Err: err}
+			continue
+		}
+
+		// Folder index files are published as part of their folder page
+		key := parentIndexKey(markdownFile.pageSettings(m).Space, markdownFile.Parents, markdownFile.Title)
+		if m.folderIndexes[key] == markdownFile.Path {
+			folder := MarkdownFile{
+				Path:     markdownFile.Path,
+				Parents:  append(append([]string{}, markdownFile.Parents...), markdownFile.Title),
+				settings: markdownFile.settings,
+			}
+			_, err := folder.FindOrCreateAncestors(m)
+			result, ok := m.parents.Published(key)
+			if err != nil || !ok {
+				result = UploadResult{Action: ActionFailed, Err: err, Duration: time.Since(start)}
+			}
+			result.File = markdownFile
+			results[i] = result
+			continue
+		}
 
 		// Create parent pages synchronously
 		if markdownFile.Ancestor == "" && len(markdownFile.Parents) > 0 {
 			var err error
-			markdownFile.Ancestor, err = markdownFile.FindOrCreateAncestors(m)
+			markdownFiles[i].Ancestor, err = markdownFile.FindOrCreateAncestors(m)
 			if err != nil {
-				errors = append(errors, err)
+				results[i] = UploadResult{
+					File:     markdownFile,
+					Action:   ActionFailed,
+					Err:      err,
+					Duration: time.Since(start),
+				}
 				continue
 			}
 		}
 
-		queue <- markdownFile
+		queue <- i
 	}
 
 	close(queue)
 
 	wg.Wait()
 
+	return results
+}
+
+// uploadErrors returns the errors of all failed uploads
+func uploadErrors(results []UploadResult) []error {
+	var errors []error
+	for _, result := range results {
+		if result.Err != nil {
+			errors = append(errors, fmt.Errorf("Unable to upload markdown file %s: \n\t%s", result.File.Path, result.Err))
+		}
+	}
 	return errors
 }
 
-func (m *Markdown2Confluence) queueProcessor(wg *sync.WaitGroup, queue *chan MarkdownFile, errors *[]error) {
+// saveState writes the pages published by the run to the state file
+func (m *Markdown2Confluence) saveState() error {
+	if m.state == nil {
+		return nil
+	}
+	if err := m.state.Save(m.StateFile); err != nil {
+		return fmt.Errorf("Unable to save state file %s: %s", m.StateFile, err)
+	}
+	return nil
+}
+
+func (m *Markdown2Confluence) queueProcessor(ctx context.Context, wg *sync.WaitGroup, queue <-chan int, markdownFiles []MarkdownFile, results []UploadResult) {
 	defer wg.Done()
 
-	for markdownFile := range *queue {
-		url, err := markdownFile.Upload(m)
+	for i := range queue {
+		if err := ctx.Err(); err != nil {
+			results[i] = UploadResult{File: markdownFiles[i], Action: ActionFailed, Err: err}
+			continue
+		}
+		results[i] = markdownFiles[i].upload(m)
+	}
+}
+
+// discover returns the markdown files to publish from the file or directory f,
+// using the settings of base
+func (m *Markdown2Confluence) discover(f string, base *Markdown2Confluence, now time.Time) ([]MarkdownFile, error) {
+	if m.Nav {
+		return m.discoverNav(f, base, now)
+	}
+
+	var markdownFiles []MarkdownFile
+	var err error
+	isDir := false
+
+	// standard input is a single document
+	if f != Stdin {
+		file, err := os.Open(f)
+		defer file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Error opening file %s", err)
+		}
+
+		stat, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading file meta %s", err)
+		}
+		isDir = stat.IsDir()
+	}
+
+	var md MarkdownFile
+
+	if isDir {
+
+		// prevent someone from accidently uploading everything under the same title
+		if m.Title != "" {
+			return nil, fmt.Errorf("--title not supported for directories")
+		}
+
+		filter := newSourceFilter(f)
+		err := filepath.Walk(f,
+			func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+
+				settings := base.settingsFor(path)
+				if pageIDParent(settings.Parent) {
+					return fmt.Errorf("parent %s of %s is a page id, which is only supported for single files", settings.Parent, path)
+				}
+				if info.IsDir() {
+					if filter.skipDir(settings, path, info) {
+						return filepath.SkipDir
+					}
+					return filter.enterDir(path)
+				}
+
+				if m.isMarkdown(path) && !filter.skipFile(settings, path) {
+
+					// Only include this file if it was modified m.Since minutes ago
+					if m.unmodified(info, now) {
+						return nil
+					}
+
+					var tempTitle string
+					var tempParents []string
+
+					relativeDir := filepath.Dir(strings.TrimPrefix(filepath.ToSlash(path), filepath.ToSlash(f)))
+					dirParents := deleteEmpty(deleteFromSlice(strings.Split(filepath.ToSlash(relativeDir), "/"), "."))
+
+					// An index file in a sub directory becomes the body of its folder page
+					if isFolderIndex(path) && len(dirParents) > 0 {
+						tempTitle = m.folderTitle(dirParents[len(dirParents)-1])
+						tempParents = m.folderTitles(dirParents[:len(dirParents)-1])
+						if settings.Parent != "" {
+							tempParents = deleteEmpty(append(strings.Split(settings.Parent, "/"), tempParents...))
+						}
+
+						// sources may be discovered repeatedly, e.g. in watch mode
+						key := parentIndexKey(settings.Space, tempParents, tempTitle)
+						if existing, ok := m.folderIndexes[key]; !ok || existing == path {
+							m.folderIndexes[key] = path
+							m.indexSettings[path] = settings
+							md = MarkdownFile{
+								Path:     path,
+								Parents:  tempParents,
+								Title:    tempTitle,
+								settings: settings,
+							}
+							if m.OrderPages {
+								md.order, err = m.pageOrders(f, path, dirParents, len(tempParents)-len(dirParents)+1, true)
+								if err != nil {
+									return err
+								}
+							}
+							markdownFiles = append(markdownFiles, md)
+							return nil
+						}
+					}
+
+					readme := strings.HasSuffix(strings.TrimSuffix(path, filepath.Ext(path)), "README")
+					folder := readme && len(dirParents) > 0
+					if readme {
+						tempTitle = strings.Split(path, "/")[len(strings.Split(path, "/"))-2]
+						tempParents = deleteFromSlice(deleteFromSlice(strings.Split(relativeDir, "/"), "."), tempTitle)
+					} else {
+						tempTitle = baseName(path)
+						tempParents = deleteFromSlice(strings.Split(relativeDir, "/"), ".")
+					}
+
+					md = MarkdownFile{
+						Path:     path,
+						Parents:  m.folderTitles(tempParents),
+						settings: settings,
+					}
+
+					if settings.Parent != "" {
+						parents := strings.Split(settings.Parent, "/")
+						md.Parents = append(parents, md.Parents...)
+						md.Parents = deleteEmpty(md.Parents)
+					}
+
+					md.Title, err = m.pageTitle(path, tempTitle, md.Parents, settings.UseDocumentTitle)
+					if err != nil {
+						return err
+					}
+
+					if m.OrderPages {
+						configured := len(deleteEmpty(md.Parents)) - len(dirParents)
+						if folder {
+							configured++
+						}
+						md.order, err = m.pageOrders(f, path, dirParents, configured, folder)
+						if err != nil {
+							return err
+						}
+					}
+
+					markdownFiles = append(markdownFiles, md)
+
+				}
+				return nil
+			})
 		if err != nil {
-			*errors = append(*errors, fmt.Errorf("Unable to upload markdown file %s: \n\t%s", markdownFile.Path, err))
+			return nil, fmt.Errorf("Unable to walk path %s: %s", f, err)
+		}
+
+	} else {
+		settings := base.settingsFor(f)
+		md = MarkdownFile{
+			Path:     f,
+			Title:    m.Title,
+			settings: settings,
+		}
+
+		if settings.Parent != "" {
+			// If parent was passed as page id
+			if pageIDParent(settings.Parent) {
+				md.Ancestor = settings.Parent
+			} else {
+				// Otherwise split parents
+				parents := strings.Split(settings.Parent, "/")
+				md.Parents = append(parents, md.Parents...)
+				md.Parents = deleteEmpty(md.Parents)
+			}
+		}
+
+		if md.Title == "" {
+			md.Title, err = m.pageTitle(f, baseName(f), md.Parents, settings.UseDocumentTitle)
+			if err != nil {
+				return nil, err
+			}
 		}
-		fmt.Printf("%s: %s\n", markdownFile.FormattedPath(), url)
+
+		markdownFiles = append(markdownFiles, md)
 	}
+	return markdownFiles, nil
 }
 
-func validateInput(s string, msg string) {
-	if s == "" {
-		fmt.Println(msg)
-		os.Exit(1)
+// pageIDParent reports whether the parent is given as page id instead of
+// titles. Page ids are only supported as parent of single files, the folder
+// pages of directories are keyed by the titles of their parents.
+func pageIDParent(parent string) bool {
+	id, err := strconv.Atoi(parent)
+	return err == nil && id > 0
+}
+
+// unmodified reports whether a file was last modified before the
+// --modified-since window
+func (m *Markdown2Confluence) unmodified(info os.FileInfo, now time.Time) bool {
+	if m.Since == 0 || info.ModTime().Unix() >= now.Add(time.Duration(m.Since*-1)*time.Minute).Unix() {
+		return false
 	}
+	m.debugf("skipping %s: last modified %s\n", info.Name(), info.ModTime())
+	return true
 }
 
-func renderContent(filePath, s string, withHardWraps bool) (content string, images []string, err error) {
+// folderIndexFiles are the file names without extension whose content is
+// used as the body of their folder page. If a folder has several, the first
+// one walked wins.
+var folderIndexFiles = []string{"README", "index"}
+
+func isFolderIndex(p string) bool {
+	for _, name := range folderIndexFiles {
+		if baseName(p) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func renderContent(filePath, s string, withHardWraps bool, extensions []GoldmarkExtension) (content string, images []string, err error) {
 	confluenceExtension := e.NewConfluenceExtension(filePath)
 	ro := goldmark.WithRendererOptions(
 		html.WithXHTML(),
@@ -312,7 +773,7 @@ func renderContent(filePath, s string, withHardWraps bool) (content string, imag
 			html.WithXHTML(),
 		)
 	}
-	md := goldmark.New(
+	options := append([]goldmark.Option{
 		goldmark.WithExtensions(extension.GFM, extension.DefinitionList),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(),
@@ -321,7 +782,8 @@ func renderContent(filePath, s string, withHardWraps bool) (content string, imag
 		goldmark.WithExtensions(
 			confluenceExtension,
 		),
-	)
+	}, goldmarkOptions(extensions)...)
+	md := goldmark.New(options...)
 
 	var buf bytes.Buffer
 	if err := md.Convert([]byte(s), &buf); err != nil {
@@ -351,11 +813,11 @@ func deleteFromSlice(s []string, del string) []string {
 	return s
 }
 
-func getDocumentTitle(p string) string {
+func (m *Markdown2Confluence) getDocumentTitle(p string) (string, error) {
 	// Read file to check for the content
-	file_content, err := ioutil.ReadFile(p)
+	file_content, err := m.readMarkdown(p)
 	if err != nil {
-		log.Fatal(err)
+		return "", fmt.Errorf("Could not open file %s:\n\t%s", p, err)
 	}
 	// Convert []byte to string and print to screen
 	text := string(file_content)
@@ -366,8 +828,8 @@ func getDocumentTitle(p string) string {
 	result := r.FindStringSubmatch(text)
 	if len(result) > 1 {
 		// assign the Title to the matching group
-		return result[1]
+		return result[1], nil
 	}
 
-	return ""
+	return "", nil
 }
@@ -0,0 +1,57 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscoverParents(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "guide"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.md", "guide/b.md"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte("# "+name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	single := filepath.Join(dir, "a.md")
+
+	tests := []struct {
+		name     string
+		source   string
+		parent   string
+		ancestor string
+		parents  []string
+		wantErr  string
+	}{
+		{"file below page id", single, "123456", "123456", nil, ""},
+		{"file below titles", single, "Docs/API", "", []string{"Docs", "API"}, ""},
+		{"directory below titles", dir, "Docs", "", []string{"Docs"}, ""},
+		{"directory below page id", dir, "123456", "", nil, "parent 123456 of " + dir + " is a page id"},
+	}
+	for _, test := range tests {
+		m := &Markdown2Confluence{Mappings: []SourceMapping{{Source: test.source, Space: "T", Parent: test.parent}}}
+		markdownFiles, err := m.discoverSources(time.Now())
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error = %v, want %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		// the first file is the one at the top of the source
+		f := markdownFiles[0]
+		if f.Ancestor != test.ancestor || !reflect.DeepEqual(f.Parents, test.parents) {
+			t.Errorf("%s: ancestor %q parents %q, want %q %q", test.name, f.Ancestor, f.Parents, test.ancestor, test.parents)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SummaryFileName is the navigation file of mdBook and GitBook
+	SummaryFileName = "SUMMARY.md"
+
+	// defaultDocsDir is the directory mkdocs reads the pages from unless docs_dir is set
+	defaultDocsDir = "docs"
+)
+
+// navFileNames are the navigation files searched for in source directories
+var navFileNames = []string{SummaryFileName, "mkdocs.yml", "mkdocs.yaml"}
+
+// navEntry is an entry of a navigation file. Sections have no path, and
+// entries with a path and children become folder pages with the file as body.
+type navEntry struct {
+	title    string
+	path     string
+	children []navEntry
+}
+
+// isNavFile reports whether p is a navigation file
+func isNavFile(p string) bool {
+	for _, name := range navFileNames {
+		if filepath.Base(p) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findNavFile returns the navigation file of the source f, which is either a
+// navigation file itself or a directory containing one
+func findNavFile(f string, stat os.FileInfo) (string, error) {
+	if !stat.IsDir() {
+		if !isNavFile(f) {
+			return "", fmt.Errorf("%s is not a navigation file, expected one of %s", f, strings.Join(navFileNames, ", "))
+		}
+		return f, nil
+	}
+	for _, name := range navFileNames {
+		p := filepath.Join(f, name)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no navigation file found in %s, expected one of %s", f, strings.Join(navFileNames, ", "))
+}
+
+// readNav parses a SUMMARY.md or mkdocs.yml navigation file
+func readNav(p string) ([]navEntry, error) {
+	dat, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open navigation file %s:\n\t%s", p, err)
+	}
+	if filepath.Base(p) == SummaryFileName {
+		return parseSummary(dat, filepath.Dir(p))
+	}
+	return parseMkdocsNav(dat, filepath.Dir(p))
+}
+
+// parseSummary reads the entries of a SUMMARY.md. Links are relative to dir.
+// Headings after the first entry start sections that hold the following
+// entries, and list items without a link are sections as well.
+func parseSummary(source []byte, dir string) ([]navEntry, error) {
+	doc := goldmark.New().Parser().Parse(text.NewReader(source))
+
+	var (
+		entries []navEntry
+		section *navEntry
+	)
+	add := func(entry navEntry) {
+		if section != nil {
+			section.children = append(section.children, entry)
+			return
+		}
+		entries = append(entries, entry)
+	}
+	flush := func() {
+		if section != nil {
+			entries = append(entries, *section)
+			section = nil
+		}
+	}
+
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		switch node := n.(type) {
+		case *ast.Heading:
+			// the heading before the first entry is the title of the summary
+			if len(entries) == 0 && section == nil {
+				continue
+			}
+			flush()
+			section = &navEntry{title: strings.TrimSpace(string(node.Text(source)))}
+		case *ast.Paragraph:
+			for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+				if link, ok := c.(*ast.Link); ok {
+					add(summaryEntry(source, dir, link, strings.TrimSpace(string(link.Text(source)))))
+				}
+			}
+		case *ast.List:
+			for _, entry := range summaryList(source, dir, node) {
+				add(entry)
+			}
+		}
+	}
+	flush()
+	return entries, nil
+}
+
+// summaryList returns the entries of a SUMMARY.md list and its nested lists
+func summaryList(source []byte, dir string, list *ast.List) []navEntry {
+	var entries []navEntry
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		var entry navEntry
+		for c := item.FirstChild(); c != nil; c = c.NextSibling() {
+			if nested, ok := c.(*ast.List); ok {
+				entry.children = append(entry.children, summaryList(source, dir, nested)...)
+				continue
+			}
+			if entry.title != "" {
+				continue
+			}
+			entry.title = strings.TrimSpace(string(c.Text(source)))
+			for l := c.FirstChild(); l != nil; l = l.NextSibling() {
+				if link, ok := l.(*ast.Link); ok {
+					linked := summaryEntry(source, dir, link, entry.title)
+					entry.title, entry.path = linked.title, linked.path
+					break
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// summaryEntry returns the entry of a SUMMARY.md link. Draft chapters with
+// an empty link are sections.
+func summaryEntry(source []byte, dir string, link *ast.Link, title string) navEntry {
+	entry := navEntry{title: strings.TrimSpace(string(link.Text(source)))}
+	if entry.title == "" {
+		entry.title = title
+	}
+	destination := string(link.Destination)
+	if i := strings.IndexAny(destination, "#?"); i >= 0 {
+		destination = destination[:i]
+	}
+	if unescaped, err := url.PathUnescape(destination); err == nil {
+		destination = unescaped
+	}
+	if destination != "" && !strings.Contains(destination, "://") {
+		entry.path = filepath.Join(dir, filepath.FromSlash(destination))
+	}
+	return entry
+}
+
+// parseMkdocsNav reads the nav section of a mkdocs.yml. Paths are relative
+// to the docs_dir, which is relative to dir.
+func parseMkdocsNav(source []byte, dir string) ([]navEntry, error) {
+	// mkdocs.yml often holds python specific tags, so only the needed keys are decoded
+	var doc yaml.Node
+	if err := yaml.Unmarshal(source, &doc); err != nil {
+		return nil, fmt.Errorf("invalid mkdocs configuration: %s", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("invalid mkdocs configuration: expected a mapping")
+	}
+
+	docsDir := defaultDocsDir
+	var nav *yaml.Node
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		switch root.Content[i].Value {
+		case "docs_dir":
+			docsDir = root.Content[i+1].Value
+		case "nav":
+			nav = root.Content[i+1]
+		}
+	}
+	if nav == nil {
+		return nil, fmt.Errorf("mkdocs configuration has no nav section")
+	}
+	if !filepath.IsAbs(docsDir) {
+		docsDir = filepath.Join(dir, docsDir)
+	}
+	return mkdocsEntries(nav, docsDir)
+}
+
+// mkdocsEntries returns the entries of a mkdocs nav list. Items are either a
+// path, or a title mapped to a path or to a list of items.
+func mkdocsEntries(list *yaml.Node, docsDir string) ([]navEntry, error) {
+	if list.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("line %d: nav must be a list", list.Line)
+	}
+
+	var entries []navEntry
+	for _, item := range list.Content {
+		var entry navEntry
+		value := item
+		switch item.Kind {
+		case yaml.ScalarNode:
+		case yaml.MappingNode:
+			if len(item.Content) != 2 {
+				return nil, fmt.Errorf("line %d: nav entries must have a single title", item.Line)
+			}
+			entry.title, value = item.Content[0].Value, item.Content[1]
+		default:
+			return nil, fmt.Errorf("line %d: invalid nav entry", item.Line)
+		}
+
+		if value.Kind == yaml.SequenceNode {
+			children, err := mkdocsEntries(value, docsDir)
+			if err != nil {
+				return nil, err
+			}
+			entry.children = children
+		} else if value.Kind == yaml.ScalarNode {
+			// links to other sites can not be published
+			if strings.Contains(value.Value, "://") {
+				continue
+			}
+			entry.path = filepath.Join(docsDir, filepath.FromSlash(value.Value))
+		} else {
+			return nil, fmt.Errorf("line %d: invalid nav entry", value.Line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// discoverNav returns the markdown files listed in the navigation file of the
+// source f, with parents, titles and order taken from the navigation
+func (m *Markdown2Confluence) discoverNav(f string, base *Markdown2Confluence, now time.Time) ([]MarkdownFile, error) {
+	stat, err := os.Stat(f)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening file %s", err)
+	}
+	if m.Title != "" {
+		return nil, fmt.Errorf("--title not supported for navigation files")
+	}
+	navFile, err := findNavFile(f, stat)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readNav(navFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading navigation file %s: %s", navFile, err)
+	}
+
+	parent := base.settingsFor(navFile).Parent
+	if pageIDParent(parent) {
+		return nil, fmt.Errorf("parent %s of %s is a page id, which is only supported for single files", parent, navFile)
+	}
+	parents := deleteEmpty(strings.Split(parent, "/"))
+	var markdownFiles []MarkdownFile
+	err = m.discoverNavEntries(navFile, base, now, newSourceFilter(filepath.Dir(navFile)), entries, parents, make([]pageOrder, len(parents)), &markdownFiles)
+	return markdownFiles, err
+}
+
+// discoverNavEntries appends the markdown files of the entries below parents
+func (m *Markdown2Confluence) discoverNavEntries(navFile string, base *Markdown2Confluence, now time.Time, filter *sourceFilter, entries []navEntry, parents []string, orders []pageOrder, markdownFiles *[]MarkdownFile) error {
+	for i, entry := range entries {
+		// the position in the navigation is the weight of the page
+		order := pageOrder{name: entry.title, weight: float64(i), hasWeight: true}
+		title := m.TitlePrefix + entry.title + m.TitleSuffix
+
+		if entry.path != "" {
+			info, err := os.Stat(entry.path)
+			if err != nil {
+				return fmt.Errorf("navigation file %s links to %s: %s", navFile, entry.path, err)
+			}
+			settings := base.settingsFor(entry.path)
+			if filter.skipFile(settings, entry.path) || m.unmodified(info, now) {
+				entry.path = ""
+			} else if entry.title == "" {
+				name := strings.TrimSuffix(filepath.Base(entry.path), filepath.Ext(entry.path))
+				title, err = m.pageTitle(entry.path, name, parents, settings.UseDocumentTitle)
+				if err != nil {
+					return err
+				}
+			}
+
+			if entry.path != "" {
+				order.name = title
+				md := MarkdownFile{
+					Path:     entry.path,
+					Parents:  append([]string{}, parents...),
+					Title:    title,
+					settings: settings,
+					order:    append(append([]pageOrder{}, orders...), order),
+				}
+				// files with children become the body of their folder page
+				if len(entry.children) > 0 {
+					key := parentIndexKey(settings.Space, parents, title)
+					if existing, ok := m.folderIndexes[key]; ok && existing != entry.path {
+						return fmt.Errorf("navigation file %s lists the pages of %s twice", navFile, title)
+					}
+					m.folderIndexes[key] = entry.path
+					m.indexSettings[entry.path] = settings
+				}
+				*markdownFiles = append(*markdownFiles, md)
+			}
+		}
+
+		if len(entry.children) == 0 {
+			continue
+		}
+		if title == m.TitlePrefix+m.TitleSuffix {
+			return fmt.Errorf("navigation file %s has a section without title", navFile)
+		}
+		if err := m.discoverNavEntries(navFile, base, now, filter, entry.children, append(append([]string{}, parents...), title), append(append([]pageOrder{}, orders...), order), markdownFiles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
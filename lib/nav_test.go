@@ -0,0 +1,117 @@
+package lib
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSummary(t *testing.T) {
+	dir := filepath.FromSlash("/book")
+	path := func(p string) string { return filepath.Join(dir, filepath.FromSlash(p)) }
+
+	tests := []struct {
+		name    string
+		summary string
+		want    []navEntry
+	}{
+		{
+			"flat list",
+			"# Summary\n\n- [Intro](intro.md)\n- [Setup](setup/index.md#top)\n",
+			[]navEntry{{title: "Intro", path: path("intro.md")}, {title: "Setup", path: path("setup/index.md")}},
+		},
+		{
+			"nested chapters",
+			"- [Guide](guide/README.md)\n  - [Install](guide/install.md)\n  - [Usage](guide/usage.md)\n",
+			[]navEntry{{title: "Guide", path: path("guide/README.md"), children: []navEntry{
+				{title: "Install", path: path("guide/install.md")},
+				{title: "Usage", path: path("guide/usage.md")},
+			}}},
+		},
+		{
+			"prefix chapters and sections",
+			"# Summary\n\n[Preface](preface.md)\n\n# Reference\n\n- [API](api.md)\n\n# Appendix\n\n- [FAQ](faq.md)\n",
+			[]navEntry{
+				{title: "Preface", path: path("preface.md")},
+				{title: "Reference", children: []navEntry{{title: "API", path: path("api.md")}}},
+				{title: "Appendix", children: []navEntry{{title: "FAQ", path: path("faq.md")}}},
+			},
+		},
+		{
+			"draft chapters and unlinked items",
+			"- [Draft]()\n- Later\n  - [Notes](my%20notes.md)\n",
+			[]navEntry{
+				{title: "Draft"},
+				{title: "Later", children: []navEntry{{title: "Notes", path: path("my notes.md")}}},
+			},
+		},
+	}
+	for _, test := range tests {
+		got, err := parseSummary([]byte(test.summary), dir)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: parseSummary = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseMkdocsNav(t *testing.T) {
+	dir := filepath.FromSlash("/site")
+	path := func(p string) string { return filepath.Join(dir, filepath.FromSlash(p)) }
+
+	tests := []struct {
+		name    string
+		mkdocs  string
+		want    []navEntry
+		wantErr bool
+	}{
+		{
+			"titles, paths and sections",
+			"site_name: Test\nnav:\n  - index.md\n  - Guide:\n      - Install: guide/install.md\n      - guide/usage.md\n  - Source: https://example.com\n",
+			[]navEntry{
+				{path: path("docs/index.md")},
+				{title: "Guide", children: []navEntry{
+					{title: "Install", path: path("docs/guide/install.md")},
+					{path: path("docs/guide/usage.md")},
+				}},
+			},
+			false,
+		},
+		{
+			"docs dir",
+			"docs_dir: content\nnav:\n  - Home: index.md\n",
+			[]navEntry{{title: "Home", path: path("content/index.md")}},
+			false,
+		},
+		{
+			"python tags",
+			"markdown_extensions:\n  - pymdownx.emoji:\n      emoji_index: !!python/name:material.extensions.emoji.twemoji\nnav:\n  - index.md\n",
+			[]navEntry{{path: path("docs/index.md")}},
+			false,
+		},
+		{"no nav", "site_name: Test\n", nil, true},
+		{"not a mapping", "- index.md\n", nil, true},
+		{"nav is not a list", "nav: index.md\n", nil, true},
+		{"several titles", "nav:\n  - A: a.md\n    B: b.md\n", nil, true},
+		{"invalid entry", "nav:\n  - Home:\n      key: value\n", nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseMkdocsNav([]byte(test.mkdocs), dir)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: parseMkdocsNav = %+v, want an error", test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: parseMkdocsNav = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
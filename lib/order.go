@@ -0,0 +1,260 @@
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OrderFileName is the name of the file listing the files and directories of
+// a directory in the order their pages should appear, one name per line
+const OrderFileName = ".order"
+
+// orderKeys are the front matter keys holding the weight of a page
+var orderKeys = []string{"weight", "position"}
+
+// pageOrder holds the ordering hints of a page: the file or directory it was
+// published from and its weight, if any
+type pageOrder struct {
+	dir       string
+	name      string
+	weight    float64
+	hasWeight bool
+}
+
+// orderedPage is a published page and its ordering hints
+type orderedPage struct {
+	id    string
+	title string
+	order pageOrder
+	// listed is the position of the page in the order file of its directory, or -1
+	listed int
+}
+
+// pageOrders returns the ordering hints of the markdown file at p found in the
+// directory source, one for every page from deleteEmpty(Parents) to the page
+// itself. configured is the number of parents set with --parent, which are not
+// reordered. folder reports whether the file is the body of the folder page
+// of its directory.
+func (m *Markdown2Confluence) pageOrders(source, p string, dirNames []string, configured int, folder bool) ([]pageOrder, error) {
+	if configured < 0 {
+		return nil, nil
+	}
+	orders := make([]pageOrder, configured)
+	folders := dirNames
+	own := pageOrder{dir: filepath.Dir(p), name: filepath.Base(p)}
+	if folder {
+		folders = dirNames[:len(dirNames)-1]
+		own = pageOrder{dir: filepath.Dir(own.dir), name: filepath.Base(own.dir)}
+	}
+
+	for i, name := range folders {
+		orders = append(orders, prefixOrder(filepath.Join(append([]string{source}, folders[:i]...)...), name, false))
+	}
+
+	own = prefixOrder(own.dir, own.name, !folder)
+	dat, err := m.readMarkdown(p)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open file %s:\n\t%s", p, err)
+	}
+	frontMatter, _ := splitFrontMatter(dat)
+	for _, key := range orderKeys {
+		value, ok := frontMatter[key]
+		if !ok {
+			continue
+		}
+		weight, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading %s: front matter %s must be a number", p, key)
+		}
+		own.weight, own.hasWeight = weight, true
+		break
+	}
+	return append(orders, own), nil
+}
+
+// prefixOrder returns the ordering hints of a file or directory, weighted by
+// its numeric prefix. The prefix is the one humanizeTitle strips, so that the
+// extension of files is not part of it.
+func prefixOrder(dir, name string, file bool) pageOrder {
+	order := pageOrder{dir: dir, name: name}
+	if file {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	order.weight, _, order.hasWeight = splitNumericPrefix(name)
+	return order
+}
+
+// readOrderFile returns the names listed in the order file of dir, skipping
+// empty lines and # comments. It returns nil if there is none.
+func readOrderFile(dir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(dir, OrderFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name != "" && !strings.HasPrefix(name, "#") {
+			names = append(names, name)
+		}
+	}
+	return names, scanner.Err()
+}
+
+// orderPages moves the published pages among their siblings so that they
+// appear in the order given by the order files, their weights and finally
+// their names. Siblings without any hint are left alone.
+func (m *Markdown2Confluence) orderPages(markdownFiles []MarkdownFile, results []UploadResult) []error {
+	var (
+		errors     []error
+		groups     = make(map[string][]*orderedPage)
+		pages      = make(map[string]*orderedPage)
+		orderFiles = make(map[string][]string)
+	)
+
+	add := func(parentID, id, title string, order pageOrder, own bool) error {
+		if page, ok := pages[id]; ok {
+			// the hints of a folder index file win over those of its folder
+			if own {
+				page.order = order
+			}
+			return nil
+		}
+		if _, ok := orderFiles[order.dir]; !ok && order.dir != "" {
+			names, err := readOrderFile(order.dir)
+			if err != nil {
+				return fmt.Errorf("Unable to read %s: %s", filepath.Join(order.dir, OrderFileName), err)
+			}
+			orderFiles[order.dir] = names
+		}
+		page := &orderedPage{id: id, title: title, order: order}
+		pages[id] = page
+		groups[parentID] = append(groups[parentID], page)
+		return nil
+	}
+
+	for i, markdownFile := range markdownFiles {
+		if results[i].PageID == "" || results[i].Err != nil {
+			continue
+		}
+		space := markdownFile.pageSettings(m).Space
+		parents := deleteEmpty(markdownFile.Parents)
+		levels := append(append([]string{}, parents...), markdownFile.Title)
+		if len(markdownFile.order) != len(levels) {
+			continue
+		}
+
+		// pages at the top of the space have no parent to order them in
+		var parentID string
+		if len(parents) == 0 {
+			parentID = markdownFile.Ancestor
+		}
+		for j, title := range levels {
+			id := results[i].PageID
+			if j < len(levels)-1 {
+				id = m.parents.ID(parentIndexKey(space, levels[:j], title))
+			}
+			if id == "" {
+				break
+			}
+			if parentID != "" && markdownFile.order[j].name != "" {
+				if err := add(parentID, id, title, markdownFile.order[j], j == len(levels)-1); err != nil {
+					errors = append(errors, err)
+				}
+			}
+			parentID = id
+		}
+	}
+
+	var parentIDs []string
+	for parentID := range groups {
+		parentIDs = append(parentIDs, parentID)
+	}
+	sort.Strings(parentIDs)
+
+	for _, parentID := range parentIDs {
+		siblings := groups[parentID]
+		hinted := false
+		for _, page := range siblings {
+			page.listed = -1
+			for k, name := range orderFiles[page.order.dir] {
+				if name == page.order.name || name == strings.TrimSuffix(page.order.name, filepath.Ext(page.order.name)) {
+					page.listed = k
+					break
+				}
+			}
+			hinted = hinted || page.listed >= 0 || page.order.hasWeight
+		}
+		if len(siblings) < 2 || !hinted {
+			continue
+		}
+
+		sort.SliceStable(siblings, func(i, j int) bool {
+			a, b := siblings[i], siblings[j]
+			if (a.listed >= 0) != (b.listed >= 0) {
+				return a.listed >= 0
+			}
+			if a.listed != b.listed {
+				return a.listed < b.listed
+			}
+			if a.order.hasWeight != b.order.hasWeight {
+				return a.order.hasWeight
+			}
+			if a.order.weight != b.order.weight {
+				return a.order.weight < b.order.weight
+			}
+			return a.order.name < b.order.name
+		})
+
+		if err := m.orderChildren(parentID, siblings); err != nil {
+			errors = append(errors, fmt.Errorf("Unable to order the children of page %s: %s", parentID, err))
+		}
+	}
+	return errors
+}
+
+// orderChildren moves the siblings below parentID into the given order,
+// unless they already appear in it
+func (m *Markdown2Confluence) orderChildren(parentID string, siblings []*orderedPage) error {
+	children, err := m.Client.ChildPages(parentID)
+	if err != nil {
+		return err
+	}
+
+	position := make(map[string]int)
+	for i, page := range siblings {
+		position[page.id] = i
+	}
+	var current []string
+	for _, child := range children {
+		if _, ok := position[child.ID]; ok {
+			current = append(current, child.ID)
+		}
+	}
+	inOrder := len(current) == len(siblings)
+	for i := 0; inOrder && i < len(current); i++ {
+		inOrder = current[i] == siblings[i].id
+	}
+	if inOrder {
+		return nil
+	}
+
+	for i := 1; i < len(siblings); i++ {
+		m.debugf("Moving page %s after %s\n", siblings[i].title, siblings[i-1].title)
+		if err := m.Client.MovePage(siblings[i].id, "after", siblings[i-1].id); err != nil {
+			return fmt.Errorf("Error moving page %s: %s", siblings[i].title, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/justmiles/go-confluence"
+)
+
+func TestPrefixOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      bool
+		weight    float64
+		hasWeight bool
+	}{
+		{"02-install.md", true, 2, true},
+		{"10_usage", false, 10, true},
+		{"3 - faq.md", true, 3, true},
+		{"2024.md", true, 0, false},
+		{"readme.md", true, 0, false},
+		{"v2", false, 0, false},
+	}
+	for _, test := range tests {
+		order := prefixOrder("dir", test.name, test.file)
+		if order.dir != "dir" || order.name != test.name || order.weight != test.weight || order.hasWeight != test.hasWeight {
+			t.Errorf("prefixOrder(%q, %t) = %+v, want weight %v, %t", test.name, test.file, order, test.weight, test.hasWeight)
+		}
+	}
+}
+
+func TestReadOrderFile(t *testing.T) {
+	dir := t.TempDir()
+	names, err := readOrderFile(dir)
+	if err != nil || names != nil {
+		t.Errorf("readOrderFile without order file = %v, %v, want nil", names, err)
+	}
+
+	content := "# first the basics\ninstall.md\n\n  usage  \n#skipped\nreference\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, OrderFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	names, err = readOrderFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"install.md", "usage", "reference"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("readOrderFile = %v, want %v", names, want)
+	}
+}
+
+func TestPageOrders(t *testing.T) {
+	source := t.TempDir()
+	files := map[string]string{
+		"01-guide/02-install.md": "---\nweight: 7\n---\n# Install\n",
+		"01-guide/usage.md":      "# Usage\n",
+		"01-guide/README.md":     "---\nposition: 3\n---\n# Guide\n",
+		"01-guide/broken.md":     "---\nweight: first\n---\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(source, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	guide := filepath.Join(source, "01-guide")
+
+	tests := []struct {
+		name       string
+		file       string
+		configured int
+		folder     bool
+		want       []pageOrder
+	}{
+		{
+			"front matter weight wins over the prefix",
+			"02-install.md", 0, false,
+			[]pageOrder{
+				{dir: source, name: "01-guide", weight: 1, hasWeight: true},
+				{dir: guide, name: "02-install.md", weight: 7, hasWeight: true},
+			},
+		},
+		{
+			"no hints",
+			"usage.md", 1, false,
+			[]pageOrder{
+				{},
+				{dir: source, name: "01-guide", weight: 1, hasWeight: true},
+				{dir: guide, name: "usage.md"},
+			},
+		},
+		{
+			"folder index",
+			"README.md", 0, true,
+			[]pageOrder{
+				{dir: source, name: "01-guide", weight: 3, hasWeight: true},
+			},
+		},
+	}
+	m := &Markdown2Confluence{}
+	for _, test := range tests {
+		got, err := m.pageOrders(source, filepath.Join(guide, test.file), []string{"01-guide"}, test.configured, test.folder)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: pageOrders = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	if _, err := m.pageOrders(source, filepath.Join(guide, "broken.md"), []string{"01-guide"}, 0, false); err == nil {
+		t.Errorf("pageOrders accepted a weight that is not a number")
+	}
+	if got, err := m.pageOrders(source, filepath.Join(guide, "usage.md"), []string{"01-guide"}, -1, false); got != nil || err != nil {
+		t.Errorf("pageOrders without parents = %v, %v, want nil", got, err)
+	}
+}
+
+// orderClient records the pages moved below a parent
+type orderClient struct {
+	Client
+	children []string
+	moves    []string
+}
+
+func (c *orderClient) ChildPages(contentID string) ([]confluence.Content, error) {
+	var children []confluence.Content
+	for _, id := range c.children {
+		children = append(children, confluence.Content{ID: id})
+	}
+	return children, nil
+}
+
+func (c *orderClient) MovePage(contentID, position, targetID string) error {
+	c.moves = append(c.moves, contentID+" "+position+" "+targetID)
+	return nil
+}
+
+func TestOrderPages(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, OrderFileName), []byte("intro\nzeta.md\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type page struct {
+		id     string
+		name   string
+		weight float64
+	}
+
+	tests := []struct {
+		name     string
+		pages    []page
+		children []string
+		want     string
+	}{
+		{
+			"order file, then weights, then names",
+			[]page{
+				{"b", "b.md", 0},
+				{"w2", "w2.md", 2},
+				{"zeta", "zeta.md", 0},
+				{"a", "a.md", 0},
+				{"intro", "intro.md", 0},
+				{"w1", "w1.md", 1},
+			},
+			[]string{"a", "b", "intro", "w1", "w2", "zeta"},
+			"zeta after intro,w1 after zeta,w2 after w1,a after w2,b after a",
+		},
+		{
+			"already in order",
+			[]page{
+				{"intro", "intro.md", 0},
+				{"x", "x.md", 0},
+			},
+			[]string{"other", "intro", "x"},
+			"",
+		},
+		{
+			"no hints",
+			[]page{
+				{"b", "b.md", 0},
+				{"a", "a.md", 0},
+			},
+			[]string{"b", "a"},
+			"",
+		},
+	}
+	for _, test := range tests {
+		var (
+			files   []MarkdownFile
+			results []UploadResult
+		)
+		for _, p := range test.pages {
+			// a zero weight stands for a page without weight
+			order := pageOrder{dir: dir, name: p.name, weight: p.weight, hasWeight: p.weight != 0}
+			files = append(files, MarkdownFile{Title: p.id, Ancestor: "root", order: []pageOrder{order}})
+			results = append(results, UploadResult{PageID: p.id})
+		}
+		client := &orderClient{children: test.children}
+		m := &Markdown2Confluence{Client: client, parents: newParentIndex()}
+		if errs := m.orderPages(files, results); len(errs) > 0 {
+			t.Errorf("%s: %v", test.name, errs)
+			continue
+		}
+		if got := strings.Join(client.moves, ","); got != test.want {
+			t.Errorf("%s: moves = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
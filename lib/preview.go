@@ -0,0 +1,441 @@
+package lib
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPreviewAddress is the address the preview server listens on
+const DefaultPreviewAddress = "localhost:8080"
+
+// previewPage is a rendered page served by the preview server
+type previewPage struct {
+	RenderedPage
+	body     string
+	children []*previewPage
+}
+
+// previewSite holds the rendered pages of the sources. It is rebuilt whenever
+// the sources change.
+type previewSite struct {
+	sync.RWMutex
+	pages   map[string]*previewPage
+	roots   []*previewPage
+	errors  []error
+	version int
+	logger  Logger
+}
+
+func previewKey(space, title string) string {
+	return space + ":" + title
+}
+
+// Preview serves the rendered sources on addr until stop is closed. The
+// sources are checked for changes every interval and open pages reload
+// automatically.
+func (m *Markdown2Confluence) Preview(addr string, interval time.Duration, stop <-chan struct{}) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+
+	site := &previewSite{logger: m.logger()}
+	markdownFiles, previous, err := m.watchSnapshot()
+	if err != nil {
+		return err
+	}
+	site.update(m, markdownFiles)
+
+	server := &http.Server{Addr: addr, Handler: site.handler()}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				server.Close()
+				return
+			case <-ticker.C:
+			}
+
+			markdownFiles, current, err := m.watchSnapshot()
+			if err != nil {
+				m.logf("%s\n", err)
+				continue
+			}
+			if !snapshotChanged(previous, current) {
+				continue
+			}
+			previous = current
+			m.debugf("Sources changed, rendering again\n")
+			site.update(m, markdownFiles)
+		}
+	}()
+
+	m.logf("Serving a preview on http://%s\n", addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func snapshotChanged(previous, current map[string]fileVersion) bool {
+	if len(previous) != len(current) {
+		return true
+	}
+	for p, version := range current {
+		if previous[p] != version {
+			return true
+		}
+	}
+	return false
+}
+
+// update renders the markdown files and replaces the pages of the site
+func (s *previewSite) update(m *Markdown2Confluence, markdownFiles []MarkdownFile) {
+	pages := make(map[string]*previewPage)
+	var order []*previewPage
+	errors := m.renderPages(markdownFiles, func(page RenderedPage, body string) error {
+		p := &previewPage{RenderedPage: page, body: body}
+		pages[previewKey(page.Space, page.Title)] = p
+		order = append(order, p)
+		return nil
+	})
+	for _, err := range errors {
+		m.logf("%s\n", err)
+	}
+
+	var roots []*previewPage
+	for _, p := range order {
+		if len(p.Parents) == 0 {
+			roots = append(roots, p)
+			continue
+		}
+		if parent, ok := pages[previewKey(p.Space, p.Parents[len(p.Parents)-1])]; ok {
+			parent.children = append(parent.children, p)
+		} else {
+			roots = append(roots, p)
+		}
+	}
+	sortPreviewPages(roots)
+	for _, p := range pages {
+		sortPreviewPages(p.children)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.pages = pages
+	s.roots = roots
+	s.errors = errors
+	s.version++
+}
+
+func sortPreviewPages(pages []*previewPage) {
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Title < pages[j].Title
+	})
+}
+
+func (s *previewSite) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.serveIndex)
+	mux.HandleFunc("/page", s.servePage)
+	mux.HandleFunc("/attachment", s.serveAttachment)
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		s.RLock()
+		defer s.RUnlock()
+		fmt.Fprint(w, s.version)
+	})
+	return mux
+}
+
+// serveIndex redirects to the first page
+func (s *previewSite) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	s.RLock()
+	defer s.RUnlock()
+	if len(s.roots) == 0 {
+		s.write(w, nil, "<p>There are no pages to preview.</p>")
+		return
+	}
+	http.Redirect(w, r, pageURL(s.roots[0].Space, s.roots[0].Title), http.StatusFound)
+}
+
+func (s *previewSite) servePage(w http.ResponseWriter, r *http.Request) {
+	s.RLock()
+	defer s.RUnlock()
+	page, ok := s.pages[previewKey(r.URL.Query().Get("space"), r.URL.Query().Get("title"))]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		s.write(w, nil, "<p>Page not found.</p>")
+		return
+	}
+
+	root, err := parseStorage(page.body)
+	if err != nil {
+		s.write(w, page, "<p>Unable to parse the rendered page: "+html.EscapeString(err.Error())+"</p>")
+		return
+	}
+	var b strings.Builder
+	s.storageHTML(&b, page, root)
+	s.write(w, page, b.String())
+}
+
+// serveAttachment serves the local images of a page
+func (s *previewSite) serveAttachment(w http.ResponseWriter, r *http.Request) {
+	s.RLock()
+	page, ok := s.pages[previewKey(r.URL.Query().Get("space"), r.URL.Query().Get("title"))]
+	s.RUnlock()
+	if ok {
+		for _, attachment := range page.Attachments {
+			if filepath.Base(attachment) == r.URL.Query().Get("file") {
+				http.ServeFile(w, r, attachment)
+				return
+			}
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func pageURL(space, title string) string {
+	return "/page?" + url.Values{"space": {space}, "title": {title}}.Encode()
+}
+
+func attachmentURL(page *previewPage, file string) string {
+	return "/attachment?" + url.Values{"space": {page.Space}, "title": {page.Title}, "file": {file}}.Encode()
+}
+
+type previewData struct {
+	Page    *previewPage
+	Tree    template.HTML
+	Body    template.HTML
+	Errors  []error
+	Version int
+}
+
+// write renders the page layout. The caller holds the read lock.
+func (s *previewSite) write(w http.ResponseWriter, page *previewPage, body string) {
+	var tree strings.Builder
+	s.treeHTML(&tree, s.roots, page)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := previewTemplate.Execute(w, previewData{
+		Page:    page,
+		Tree:    template.HTML(tree.String()),
+		Body:    template.HTML(body),
+		Errors:  s.errors,
+		Version: s.version,
+	})
+	if err != nil {
+		s.logger.Printf("%s\n", err)
+	}
+}
+
+// treeHTML writes the navigation tree, highlighting the current page
+func (s *previewSite) treeHTML(b *strings.Builder, pages []*previewPage, current *previewPage) {
+	if len(pages) == 0 {
+		return
+	}
+	b.WriteString("<ul>")
+	for _, p := range pages {
+		class := ""
+		if p == current {
+			class = ` class="current"`
+		}
+		fmt.Fprintf(b, `<li><a%s href="%s">%s</a>`, class, html.EscapeString(pageURL(p.Space, p.Title)), html.EscapeString(p.Title))
+		s.treeHTML(b, p.children, current)
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ul>")
+}
+
+// voidElements are written as self-closing tags
+var voidElements = map[string]bool{"br": true, "hr": true, "img": true, "col": true}
+
+// storageHTML translates the storage format elements emitted by the renderer
+// into HTML a browser can display
+func (s *previewSite) storageHTML(b *strings.Builder, page *previewPage, n *storageNode) {
+	children := func() {
+		for _, c := range n.children {
+			s.storageHTML(b, page, c)
+		}
+	}
+
+	switch n.name {
+	case "":
+		b.WriteString(html.EscapeString(n.text))
+	case "root", "ac:rich-text-body", "ac:link-body", "ac:plain-text-link-body", "ac:task-body":
+		children()
+	case "ac:parameter", "ac:task-id", "ac:task-status", "ac:placeholder":
+	case "ac:structured-macro":
+		s.macroHTML(b, page, n)
+	case "ac:image":
+		src := ""
+		if attachment := n.child("ri:attachment"); attachment != nil {
+			src = attachmentURL(page, attachment.attrs["ri:filename"])
+		} else if u := n.child("ri:url"); u != nil {
+			src = u.attrs["ri:value"]
+		}
+		fmt.Fprintf(b, `<img src="%s" />`, html.EscapeString(src))
+	case "ac:link":
+		href, text := "", ""
+		if target := n.child("ri:page"); target != nil {
+			text = target.attrs["ri:content-title"]
+			space := page.Space
+			if key := target.attrs["ri:space-key"]; key != "" {
+				space = key
+			}
+			href = pageURL(space, text)
+		} else if attachment := n.child("ri:attachment"); attachment != nil {
+			text = attachment.attrs["ri:filename"]
+			href = attachmentURL(page, text)
+		}
+		if anchor := n.attrs["ac:anchor"]; anchor != "" {
+			href += "#" + anchor
+		}
+		fmt.Fprintf(b, `<a href="%s">`, html.EscapeString(href))
+		if n.child("ac:link-body") != nil || n.child("ac:plain-text-link-body") != nil {
+			children()
+		} else {
+			b.WriteString(html.EscapeString(text))
+		}
+		b.WriteString("</a>")
+	case "ac:task-list":
+		b.WriteString(`<ul class="tasks">`)
+		children()
+		b.WriteString("</ul>")
+	case "ac:task":
+		checked := ""
+		if status := n.child("ac:task-status"); status != nil && strings.TrimSpace(status.textContent()) == "complete" {
+			checked = " checked"
+		}
+		fmt.Fprintf(b, `<li><input type="checkbox" disabled%s /> `, checked)
+		children()
+		b.WriteString("</li>")
+	default:
+		if strings.HasPrefix(n.name, "ac:") || strings.HasPrefix(n.name, "ri:") {
+			children()
+			return
+		}
+		b.WriteString("<" + n.name)
+		for name, value := range n.attrs {
+			fmt.Fprintf(b, ` %s="%s"`, name, html.EscapeString(value))
+		}
+		if voidElements[n.name] {
+			b.WriteString(" />")
+			return
+		}
+		b.WriteString(">")
+		children()
+		b.WriteString("</" + n.name + ">")
+	}
+}
+
+func (s *previewSite) macroHTML(b *strings.Builder, page *previewPage, n *storageNode) {
+	name := n.attrs["ac:name"]
+	switch name {
+	case "code", "noformat":
+		body := ""
+		if plain := n.child("ac:plain-text-body"); plain != nil {
+			body = strings.TrimSuffix(strings.TrimPrefix(plain.textContent(), " "), " ")
+		}
+		fmt.Fprintf(b, `<pre class="code"><code class="language-%s">%s</code></pre>`, html.EscapeString(n.macroParameter("language")), html.EscapeString(body))
+	case "children":
+		all := n.macroParameter("all") == "true"
+		depth, _ := strconv.Atoi(n.macroParameter("depth"))
+		if all {
+			depth = 0
+		} else if depth == 0 {
+			depth = 1
+		}
+		s.childrenHTML(b, page.children, depth)
+	default:
+		label, ok := panelMacros[name]
+		if !ok {
+			label = name
+		}
+		if title := n.macroParameter("title"); title != "" {
+			label = title
+		}
+		class := "macro"
+		if ok {
+			class = "panel panel-" + name
+		}
+		fmt.Fprintf(b, `<div class="%s"><div class="macro-title">%s</div>`, class, html.EscapeString(label))
+		if rich := n.child("ac:rich-text-body"); rich != nil {
+			s.storageHTML(b, page, rich)
+		}
+		b.WriteString("</div>")
+	}
+}
+
+// childrenHTML lists the child pages like the children macro, depth 0 lists all descendants
+func (s *previewSite) childrenHTML(b *strings.Builder, pages []*previewPage, depth int) {
+	if len(pages) == 0 {
+		return
+	}
+	b.WriteString("<ul>")
+	for _, p := range pages {
+		fmt.Fprintf(b, `<li><a href="%s">%s</a>`, html.EscapeString(pageURL(p.Space, p.Title)), html.EscapeString(p.Title))
+		if depth != 1 {
+			s.childrenHTML(b, p.children, depth-1)
+		}
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ul>")
+}
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{with .Page}}{{.Title}} - {{end}}markdown2confluence preview</title>
+<style>
+body { margin: 0; display: flex; font-family: -apple-system, "Segoe UI", Roboto, sans-serif; color: #172b4d; }
+nav { width: 280px; min-height: 100vh; padding: 16px; background: #f4f5f7; box-sizing: border-box; }
+nav ul { list-style: none; padding-left: 12px; }
+nav a { color: #42526e; text-decoration: none; }
+nav a.current { font-weight: bold; color: #0052cc; }
+main { flex: 1; padding: 16px 40px; max-width: 960px; }
+.breadcrumbs { color: #6b778c; font-size: 14px; }
+pre.code { background: #f4f5f7; border: 1px solid #dfe1e6; padding: 8px; overflow: auto; }
+.panel, .macro { border-radius: 3px; padding: 8px 16px; margin: 8px 0; }
+.panel-info { background: #deebff; } .panel-note { background: #eae6ff; } .panel-tip { background: #e3fcef; }
+.panel-warning { background: #ffebe6; } .panel-panel { border: 1px solid #dfe1e6; } .macro { border: 1px dashed #c1c7d0; }
+.macro-title { font-weight: bold; }
+ul.tasks { list-style: none; padding-left: 0; }
+table { border-collapse: collapse; } th, td { border: 1px solid #c1c7d0; padding: 4px 8px; } th { background: #f4f5f7; }
+img { max-width: 100%; }
+.errors { background: #ffebe6; padding: 8px 16px; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<nav>{{.Tree}}</nav>
+<main>
+{{range .Errors}}<div class="errors">{{.}}</div>{{end}}
+{{with .Page}}<div class="breadcrumbs">{{.Space}}{{range .Parents}} / {{.}}{{end}}</div>
+<h1>{{.Title}}</h1>{{end}}
+{{.Body}}
+</main>
+<script>
+var version = "{{.Version}}";
+setInterval(function () {
+  fetch("/version").then(function (r) { return r.text(); }).then(function (v) {
+    if (v !== version) { location.reload(); }
+  }).catch(function () {});
+}, 1000);
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,230 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/justmiles/go-confluence"
+)
+
+// pulledPage is a Confluence page and the markdown file it is written to
+type pulledPage struct {
+	content  confluence.Content
+	path     string
+	children []*pulledPage
+}
+
+// ValidatePull checks the settings needed to pull pages
+func (m Markdown2Confluence) ValidatePull() error {
+	if m.Space == "" {
+		return fmt.Errorf("--space is not defined")
+	}
+	return m.ValidateConnection()
+}
+
+// Pull downloads the page tree below the parent page, or all pages of the
+// space if there is no parent, as markdown files into dir. Pages with children
+// are written to a README.md in a directory named after the page, so that
+// publishing the directory recreates the hierarchy.
+func (m *Markdown2Confluence) Pull(dir string) []error {
+	if m.Client == nil {
+		m.CreateClient()
+	}
+
+	contents, err := m.spacePages()
+	if err != nil {
+		return []error{fmt.Errorf("Error fetching pages of space %s: %s", m.Space, err)}
+	}
+
+	roots, err := pageTree(contents, m.Parent)
+	if err != nil {
+		return []error{err}
+	}
+
+	pages := make(map[string]*pulledPage)
+	assignPaths(roots, "", pages)
+
+	var errors []error
+	var pull func(pages []*pulledPage)
+	pull = func(children []*pulledPage) {
+		for _, page := range children {
+			if err := m.pullPage(dir, page, pages); err != nil {
+				errors = append(errors, fmt.Errorf("Unable to pull page %s: \n\t%s", page.content.Title, err))
+			} else {
+				m.logf("pulled %s: %s\n", page.content.Title, filepath.Join(dir, filepath.FromSlash(page.path)))
+			}
+			pull(page.children)
+		}
+	}
+	pull(roots)
+	return errors
+}
+
+// spacePages fetches all pages of the space with their ancestors and body
+func (m *Markdown2Confluence) spacePages() ([]confluence.Content, error) {
+	// without a limit the client fetches all pages
+	contents, err := m.Client.GetContent(&confluence.GetContentQueryParameters{
+		Spacekey: m.Space,
+		Type:     "page",
+		Expand:   []string{"ancestors", "body.storage", "version"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.debugf("Fetched %d pages of space %s\n", len(contents), m.Space)
+	return contents, nil
+}
+
+// pageTree arranges the pages by their direct ancestor and returns the
+// children of the parent, identified by id or title. Without a parent the top
+// level pages of the space are returned.
+func pageTree(contents []confluence.Content, parent string) ([]*pulledPage, error) {
+	byID := make(map[string]*pulledPage, len(contents))
+	for _, content := range contents {
+		byID[content.ID] = &pulledPage{content: content}
+	}
+
+	var roots []*pulledPage
+	for _, content := range contents {
+		page := byID[content.ID]
+		if len(content.Ancestors) == 0 {
+			roots = append(roots, page)
+			continue
+		}
+		if ancestor, ok := byID[content.Ancestors[len(content.Ancestors)-1].ID]; ok {
+			ancestor.children = append(ancestor.children, page)
+		}
+	}
+
+	for _, page := range byID {
+		sortPages(page.children)
+	}
+	sortPages(roots)
+
+	if parent == "" {
+		return roots, nil
+	}
+	if page, ok := byID[parent]; ok {
+		return page.children, nil
+	}
+	for _, page := range byID {
+		if page.content.Title == parent {
+			return page.children, nil
+		}
+	}
+	return nil, fmt.Errorf("Error finding parent page %s", parent)
+}
+
+func sortPages(pages []*pulledPage) {
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].content.Title < pages[j].content.Title
+	})
+}
+
+// assignPaths sets the markdown file of every page, relative to the output
+// directory and slash separated
+func assignPaths(pages []*pulledPage, dir string, byTitle map[string]*pulledPage) {
+	used := make(map[string]bool)
+	for _, page := range pages {
+		name := fileName(page.content.Title)
+		if used[strings.ToLower(name)] {
+			name = name + "-" + page.content.ID
+		}
+		used[strings.ToLower(name)] = true
+
+		if len(page.children) > 0 {
+			page.path = path.Join(dir, name, "README.md")
+			assignPaths(page.children, path.Join(dir, name), byTitle)
+		} else {
+			page.path = path.Join(dir, name+".md")
+		}
+		byTitle[page.content.Title] = page
+	}
+}
+
+var unsafeFileNameCharacters = regexp.MustCompile(`[/\\:*?"<>|\x00-\x1f]+`)
+
+// fileName returns a file name for a page title
+func fileName(title string) string {
+	name := strings.TrimSpace(unsafeFileNameCharacters.ReplaceAllString(title, "-"))
+	name = strings.Trim(name, ".")
+	if name == "" {
+		return "untitled"
+	}
+	return name
+}
+
+// pullPage writes the markdown of a page and downloads its attachments
+func (m *Markdown2Confluence) pullPage(dir string, page *pulledPage, pages map[string]*pulledPage) error {
+	attachmentDir := path.Join(path.Dir(page.path), "attachments", fileName(page.content.Title))
+	converter := &storageConverter{
+		pageLink: func(title string) string {
+			if linked, ok := pages[title]; ok {
+				return relativeLink(page.path, linked.path)
+			}
+			return ""
+		},
+		attachmentLink: func(filename string) string {
+			return relativeLink(page.path, path.Join(attachmentDir, fileName(filename)))
+		},
+	}
+
+	markdown, err := converter.storageToMarkdown(page.content.Body.Storage.Value)
+	if err != nil {
+		return fmt.Errorf("Error converting storage format: %s", err)
+	}
+
+	p := filepath.Join(dir, filepath.FromSlash(page.path))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p, []byte(markdown), 0644); err != nil {
+		return fmt.Errorf("Error writing %s: %s", p, err)
+	}
+
+	return m.downloadAttachments(page.content.ID, filepath.Join(dir, filepath.FromSlash(attachmentDir)))
+}
+
+// downloadAttachments saves all attachments of a page into dir, which is
+// only created if the page has attachments
+func (m *Markdown2Confluence) downloadAttachments(pageID, dir string) error {
+	attachments, err := m.Client.FetchAttachmentMetaData(pageID)
+	if err != nil {
+		return fmt.Errorf("Error fetching attachments: %s", err)
+	}
+	if len(attachments.Results) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, attachment := range attachments.Results {
+		p := filepath.Join(dir, fileName(attachment.Title))
+		m.debugf("Downloading attachment %s to %s\n", attachment.Title, p)
+		if err := m.download(attachment.Links.Download, p); err != nil {
+			return fmt.Errorf("Error downloading attachment %s: %s", attachment.Title, err)
+		}
+	}
+	return nil
+}
+
+// download writes the attachment at the download link to the file p
+func (m *Markdown2Confluence) download(link, p string) error {
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if err := m.Client.DownloadAttachment(link, f); err != nil {
+		f.Close()
+		os.Remove(p)
+		return err
+	}
+	return f.Close()
+}
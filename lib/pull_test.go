@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/justmiles/go-confluence"
+)
+
+// pullClient serves a space with a page holding an image and a page without
+// attachments
+type pullClient struct {
+	Client
+}
+
+func (c *pullClient) GetContent(qp *confluence.GetContentQueryParameters) ([]confluence.Content, error) {
+	diagram := confluence.Content{ID: "1", Title: "Diagram"}
+	diagram.Body.Storage.Value = `<p><ac:image><ri:attachment ri:filename="a.png" /></ac:image></p>`
+	plain := confluence.Content{ID: "2", Title: "Plain"}
+	plain.Body.Storage.Value = "<p>text</p>"
+	return []confluence.Content{diagram, plain}, nil
+}
+
+func (c *pullClient) FetchAttachmentMetaData(contentID string) (*confluence.AttachmentResults, error) {
+	attachments := &confluence.AttachmentResults{}
+	if contentID == "1" {
+		attachment := confluence.AttachmentFetchResult{Title: "a.png"}
+		attachment.Links.Download = "/download/attachments/1/a.png"
+		attachments.Results = append(attachments.Results, attachment)
+	}
+	return attachments, nil
+}
+
+func (c *pullClient) DownloadAttachment(link string, w io.Writer) error {
+	_, err := io.WriteString(w, "image of "+link)
+	return err
+}
+
+func TestPull(t *testing.T) {
+	dir := t.TempDir()
+	m := &Markdown2Confluence{Space: "DOCS", Client: &pullClient{}, Logger: writerLogger{ioutil.Discard}}
+	if errs := m.Pull(dir); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	var files []string
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && p != dir {
+			rel, _ := filepath.Rel(dir, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	sort.Strings(files)
+	want := []string{"Diagram.md", "Plain.md", "attachments", "attachments/Diagram", "attachments/Diagram/a.png"}
+	if strings.Join(files, " ") != strings.Join(want, " ") {
+		t.Errorf("pulled %v, want %v", files, want)
+	}
+
+	dat, err := ioutil.ReadFile(filepath.Join(dir, "attachments", "Diagram", "a.png"))
+	if err != nil || string(dat) != "image of /download/attachments/1/a.png" {
+		t.Errorf("attachment = %q, %v", dat, err)
+	}
+}
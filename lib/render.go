@@ -0,0 +1,148 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ManifestFileName is the name of the manifest written by Render
+const ManifestFileName = "manifest.json"
+
+// RenderedPage describes a page written by Render
+type RenderedPage struct {
+	Title       string   `json:"title"`
+	Space       string   `json:"space"`
+	Parents     []string `json:"parents,omitempty"`
+	Ancestor    string   `json:"ancestor,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Output      string   `json:"output"`
+	Folder      bool     `json:"folder,omitempty"`
+	Attachments []string `json:"attachments,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	Comment     string   `json:"comment,omitempty"`
+}
+
+// ValidateRender checks the settings needed to render pages offline
+func (m Markdown2Confluence) ValidateRender() error {
+	return m.validateSources()
+}
+
+// Render converts the sources into storage format without connecting to
+// Confluence. Every page, including the folder pages that would be created,
+// is written to <title>.xhtml in dir next to a manifest of the pages. If dir
+// is "-" the pages are written to stdout instead.
+func (m *Markdown2Confluence) Render(dir string) []error {
+	if err := m.prepare(); err != nil {
+		return []error{err}
+	}
+
+	markdownFiles, err := m.discoverAll(time.Now())
+	if err != nil {
+		return []error{err}
+	}
+	if m.ChangedSince != "" {
+		markdownFiles, err = m.filterChanged(markdownFiles)
+		if err != nil {
+			return []error{err}
+		}
+	}
+
+	if dir != "-" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return []error{err}
+		}
+	}
+
+	var (
+		manifest []RenderedPage
+		outputs  = make(map[string]bool)
+	)
+	errors := m.renderPages(markdownFiles, func(page RenderedPage, body string) error {
+		if dir == "-" {
+			location := strings.Join(append(append([]string{page.Space}, page.Parents...), page.Title), "/")
+			fmt.Fprintf(m.stdout(), "<!-- %s -->\n%s\n", strings.TrimPrefix(location, "/"), body)
+			return nil
+		}
+
+		name := fileName(page.Title)
+		if outputs[name] {
+			name = fileName(page.Space + "-" + page.Title)
+		}
+		outputs[name] = true
+		page.Output = name + ".xhtml"
+		manifest = append(manifest, page)
+		return ioutil.WriteFile(filepath.Join(dir, page.Output), []byte(body), 0644)
+	})
+
+	if dir == "-" {
+		return errors
+	}
+
+	dat, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return append(errors, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ManifestFileName), append(dat, '\n'), 0644); err != nil {
+		errors = append(errors, fmt.Errorf("Unable to write manifest: %s", err))
+	}
+	return errors
+}
+
+// renderPages renders the markdown files and the folder pages that would be
+// created for them, and passes every page to write
+func (m *Markdown2Confluence) renderPages(markdownFiles []MarkdownFile, write func(page RenderedPage, body string) error) []error {
+	var (
+		errors  []error
+		folders = make(map[string]bool)
+	)
+	for _, markdownFile := range markdownFiles {
+		settings := markdownFile.pageSettings(m)
+
+		// folder pages without an index file are generated
+		var path []string
+		for _, parent := range deleteEmpty(markdownFile.Parents) {
+			key := parentIndexKey(settings.Space, path, parent)
+			if _, ok := m.folderIndexes[key]; !ok && !folders[key] {
+				folders[key] = true
+				body, images, err := m.folderPageContent(path, parent)
+				if err == nil {
+					err = write(RenderedPage{
+						Title:       parent,
+						Space:       settings.Space,
+						Parents:     append([]string{}, path...),
+						Folder:      true,
+						Attachments: images,
+					}, body)
+				}
+				if err != nil {
+					errors = append(errors, fmt.Errorf("Unable to render folder page %s: \n\t%s", parent, err))
+				}
+			}
+			path = append(path, parent)
+		}
+
+		body, images, comment, err := markdownFile.render(m)
+		if err == nil {
+			err = write(RenderedPage{
+				Title:       markdownFile.Title,
+				Space:       settings.Space,
+				Parents:     deleteEmpty(markdownFile.Parents),
+				Ancestor:    markdownFile.Ancestor,
+				Source:      markdownFile.Path,
+				Folder:      m.folderIndexes[parentIndexKey(settings.Space, markdownFile.Parents, markdownFile.Title)] == markdownFile.Path,
+				Attachments: images,
+				Labels:      settings.Labels,
+				Comment:     comment,
+			}, body)
+		}
+		if err != nil {
+			errors = append(errors, fmt.Errorf("Unable to render markdown file %s: \n\t%s", markdownFile.Path, err))
+		}
+	}
+	return errors
+}
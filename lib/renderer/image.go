@@ -48,7 +48,7 @@ func (r *ConfluenceImageHTMLRender) renderConfluenceImage(w util.BufWriter, sour
 	n := node.(*ast.Image)
 
 	// If this is a local file and not an HTTP url, then let's render this for Confluence
-	if f, err := localFile(r.filePath, n.Destination); err == nil {
+	if f, err := LocalFile(r.filePath, n.Destination); err == nil {
 		r.Images = append(r.Images, f)
 		_, _ = w.WriteString(`<ac:image><ri:attachment ri:filename="`)
 		_, _ = w.WriteString(path.Base(f))
@@ -99,7 +99,9 @@ func RenderImageAttributes(w util.BufWriter, node ast.Node, filter util.BytesFil
 	}
 }
 
-func localFile(filePath string, destination []byte) (string, error) {
+// LocalFile resolves an image destination of the markdown file at filePath to
+// an existing local file, or returns an error if there is none
+func LocalFile(filePath string, destination []byte) (string, error) {
 
 	localizedPath := string(destination)
 	_, err := os.Stat(localizedPath)
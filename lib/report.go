@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"text/tabwriter"
+	"time"
+)
+
+// Action describes what happened to a page during a run
+type Action string
+
+const (
+	// ActionCreated is reported for pages that did not exist yet
+	ActionCreated Action = "created"
+	// ActionUpdated is reported for existing pages whose content changed
+	ActionUpdated Action = "updated"
+	// ActionUnchanged is reported for existing pages whose content did not change
+	ActionUnchanged Action = "unchanged"
+	// ActionFailed is reported for files that could not be published
+	ActionFailed Action = "failed"
+)
+
+const (
+	// OutputText prints one line per published file
+	OutputText = "text"
+	// OutputJSON prints a JSON report of the published files
+	OutputJSON = "json"
+)
+
+// UploadResult is the outcome of publishing a single MarkdownFile
+type UploadResult struct {
+	File        MarkdownFile
+	Action      Action
+	PageID      string
+	Version     int
+	URL         string
+	WebURL      string
+	Attachments []string
+	Duration    time.Duration
+	Err         error
+}
+
+// ReportError writes the report of a run that failed with err before
+// publishing any file
+func (m *Markdown2Confluence) ReportError(err error) error {
+	return m.report(nil, err)
+}
+
+// ReportEntry is the JSON representation of an UploadResult
+type ReportEntry struct {
+	Path        string   `json:"path"`
+	Title       string   `json:"title"`
+	Space       string   `json:"space"`
+	PageID      string   `json:"pageId,omitempty"`
+	Version     int      `json:"version,omitempty"`
+	WebURL      string   `json:"webUrl,omitempty"`
+	TinyURL     string   `json:"tinyUrl,omitempty"`
+	Action      Action   `json:"action"`
+	Attachments []string `json:"attachments,omitempty"`
+	DurationMs  int64    `json:"durationMs"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// Report is the JSON report of a run
+type Report struct {
+	Files []ReportEntry `json:"files"`
+	// Error is set if the run failed before or after publishing the files
+	Error string `json:"error,omitempty"`
+}
+
+// report writes the results and the error of the run, if any, in the
+// configured output format and to the report and JUnit files. The JSON report
+// is written even if the run failed before publishing anything.
+func (m *Markdown2Confluence) report(results []UploadResult, runErr error) error {
+	if m.JUnitFile != "" && results != nil {
+		if err := m.writeJUnit(m.JUnitFile, results, time.Now()); err != nil {
+			return err
+		}
+	}
+	if m.Output != OutputJSON {
+		if results != nil {
+			printReport(m.stdout(), results)
+		}
+		if m.ReportFile == "" {
+			return nil
+		}
+	}
+
+	report := Report{Files: m.reportEntries(results)}
+	if runErr != nil {
+		report.Error = runErr.Error()
+	}
+	dat, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	dat = append(dat, '\n')
+
+	if m.Output == OutputJSON {
+		m.stdout().Write(dat)
+	}
+	if m.ReportFile != "" {
+		if err := ioutil.WriteFile(m.ReportFile, dat, 0644); err != nil {
+			return fmt.Errorf("Unable to write report file %s: %s", m.ReportFile, err)
+		}
+	}
+	return nil
+}
+
+// reportEntries converts the results into report entries
+func (m *Markdown2Confluence) reportEntries(results []UploadResult) []ReportEntry {
+	entries := make([]ReportEntry, 0, len(results))
+	for _, r := range results {
+		entry := ReportEntry{
+			Path:        r.File.Path,
+			Title:       r.File.Title,
+			Space:       r.File.pageSettings(m).Space,
+			PageID:      r.PageID,
+			Version:     r.Version,
+			WebURL:      r.WebURL,
+			TinyURL:     r.URL,
+			Action:      r.Action,
+			Attachments: r.Attachments,
+			DurationMs:  r.Duration.Milliseconds(),
+		}
+		if r.Err != nil {
+			entry.Error = r.Err.Error()
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// printReport writes one line per result, in the order the files were discovered
+func printReport(out io.Writer, results []UploadResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Action, r.File.FormattedPath(), r.URL, r.Duration.Round(time.Millisecond))
+	}
+	w.Flush()
+}
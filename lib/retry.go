@@ -0,0 +1,160 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultRetryAttempts is how often a Confluence API call is attempted before giving up
+	DefaultRetryAttempts = 5
+
+	// DefaultRetryMaxWait caps the time to wait between two attempts
+	DefaultRetryMaxWait = time.Minute
+
+	retryBaseWait = 500 * time.Millisecond
+)
+
+// retryTransport is a http.RoundTripper that retries requests which were rate
+// limited or hit a temporarily unavailable Confluence instance. It backs off
+// exponentially with jitter, unless the response carries a Retry-After header.
+// Requests that are not idempotent, like creating pages and uploading
+// attachments, are only retried if Confluence rejected them with 429, since
+// they may have been processed otherwise.
+type retryTransport struct {
+	Attempts int
+	MaxWait  time.Duration
+	Debug    bool
+	// Logger receives the retry messages. Defaults to standard output
+	Logger Logger
+
+	// Next is the transport performing the request. Defaults to http.DefaultTransport
+	Next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	ctx := req.Context()
+	attemptReq := req
+	for attempt := 1; ; attempt++ {
+		res, err := next.RoundTrip(attemptReq)
+		if attempt >= t.Attempts || ctx.Err() != nil || !retryable(req.Method, res, err) {
+			return res, err
+		}
+
+		// the request body has already been consumed, the next attempt sends
+		// a copy of the request with a fresh body
+		attemptReq = req.Clone(ctx)
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return res, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return res, err
+			}
+			attemptReq.Body = body
+		}
+
+		wait := t.backoff(attempt, res)
+		if t.Debug {
+			reason := fmt.Sprint(err)
+			if res != nil {
+				reason = res.Status
+			}
+			logger := t.Logger
+			if logger == nil {
+				logger = writerLogger{os.Stdout}
+			}
+			logger.Printf("Retrying %s %s in %s (attempt %d of %d): %s\n", req.Method, req.URL.Path, wait, attempt+1, t.Attempts, reason)
+		}
+
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns how long to wait before the next attempt
+func (t *retryTransport) backoff(attempt int, res *http.Response) time.Duration {
+	maxWait := t.MaxWait
+	if maxWait <= 0 {
+		maxWait = DefaultRetryMaxWait
+	}
+
+	if res != nil {
+		if wait, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+			if wait > maxWait {
+				return maxWait
+			}
+			return wait
+		}
+	}
+
+	wait := retryBaseWait << (attempt - 1)
+	if wait <= 0 || wait > maxWait {
+		wait = maxWait
+	}
+	// full jitter keeps parallel workers from retrying in lockstep
+	return time.Duration(rand.Int63n(int64(wait)) + 1)
+}
+
+// retryable reports whether a request may succeed when sent again. Only
+// rate limited requests are known not to have been processed, all other
+// failures are only retried for idempotent methods.
+func retryable(method string, res *http.Response, err error) bool {
+	if err == nil && res.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header, which is either a number of
+// seconds or a HTTP date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
@@ -0,0 +1,169 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		wait  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0, true},
+	}
+	for _, test := range tests {
+		wait, ok := retryAfter(test.value)
+		if wait != test.wait || ok != test.ok {
+			t.Errorf("retryAfter(%q) = %s, %t, want %s, %t", test.value, wait, ok, test.wait, test.ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxWait    time.Duration
+		attempt    int
+		retryAfter string
+		min, max   time.Duration
+	}{
+		{"first attempt", time.Minute, 1, "", 1, retryBaseWait},
+		{"grows exponentially", time.Minute, 3, "", 1, 4 * retryBaseWait},
+		{"capped", time.Second, 10, "", 1, time.Second},
+		{"overflow capped", time.Second, 100, "", 1, time.Second},
+		{"default max wait", 0, 100, "", 1, DefaultRetryMaxWait},
+		{"retry after", time.Minute, 1, "7", 7 * time.Second, 7 * time.Second},
+		{"retry after capped", 5 * time.Second, 1, "7", 5 * time.Second, 5 * time.Second},
+	}
+	for _, test := range tests {
+		transport := &retryTransport{MaxWait: test.maxWait}
+		var res *http.Response
+		if test.retryAfter != "" {
+			res = &http.Response{Header: http.Header{"Retry-After": {test.retryAfter}}}
+		}
+		for i := 0; i < 20; i++ {
+			if wait := transport.backoff(test.attempt, res); wait < test.min || wait > test.max {
+				t.Errorf("%s: backoff = %s, want between %s and %s", test.name, wait, test.min, test.max)
+				break
+			}
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		method string
+		status int
+		err    error
+		want   bool
+	}{
+		{http.MethodGet, http.StatusOK, nil, false},
+		{http.MethodGet, http.StatusNotFound, nil, false},
+		{http.MethodGet, http.StatusTooManyRequests, nil, true},
+		{http.MethodGet, http.StatusBadGateway, nil, true},
+		{http.MethodGet, http.StatusServiceUnavailable, nil, true},
+		{http.MethodGet, http.StatusGatewayTimeout, nil, true},
+		{http.MethodGet, 0, errors.New("connection reset"), true},
+		{http.MethodPut, http.StatusServiceUnavailable, nil, true},
+		{http.MethodPost, http.StatusTooManyRequests, nil, true},
+		{http.MethodPost, http.StatusBadGateway, nil, false},
+		{http.MethodPost, http.StatusGatewayTimeout, nil, false},
+		{http.MethodPost, 0, errors.New("timeout"), false},
+	}
+	for _, test := range tests {
+		var res *http.Response
+		if test.err == nil {
+			res = &http.Response{StatusCode: test.status}
+		}
+		if got := retryable(test.method, res, test.err); got != test.want {
+			t.Errorf("retryable(%s, %d, %v) = %t, want %t", test.method, test.status, test.err, got, test.want)
+		}
+	}
+}
+
+// roundTripFunc answers requests with a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func response(status int) *http.Response {
+	return &http.Response{StatusCode: status, Status: http.StatusText(status), Header: http.Header{"Retry-After": {"0"}}, Body: ioutil.NopCloser(strings.NewReader(""))}
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		statuses []int
+		attempts int
+		want     int
+	}{
+		{"success", http.MethodGet, []int{200}, 1, 200},
+		{"retried get", http.MethodGet, []int{503, 502, 200}, 3, 200},
+		{"attempts exhausted", http.MethodGet, []int{503, 503, 503}, 3, 503},
+		{"post not retried", http.MethodPost, []int{504, 200}, 1, 504},
+		{"rate limited post", http.MethodPost, []int{429, 200}, 2, 200},
+	}
+	for _, test := range tests {
+		var bodies []string
+		transport := &retryTransport{
+			Attempts: 3,
+			Next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				dat, _ := ioutil.ReadAll(req.Body)
+				bodies = append(bodies, string(dat))
+				return response(test.statuses[len(bodies)-1]), nil
+			}),
+		}
+
+		req, _ := http.NewRequest(test.method, "http://confluence/rest/api/content", strings.NewReader("body"))
+		original := req.Body
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if res.StatusCode != test.want || len(bodies) != test.attempts {
+			t.Errorf("%s: got %d after %d attempts, want %d after %d", test.name, res.StatusCode, len(bodies), test.want, test.attempts)
+		}
+		for i, body := range bodies {
+			if body != "body" {
+				t.Errorf("%s: attempt %d sent body %q", test.name, i+1, body)
+			}
+		}
+		if req.Body != original {
+			t.Errorf("%s: request was modified", test.name)
+		}
+	}
+}
+
+func TestRetryTransportContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	transport := &retryTransport{
+		Attempts: 5,
+		Next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			cancel()
+			return response(http.StatusServiceUnavailable), nil
+		}),
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://confluence/rest/api/content", nil)
+	transport.RoundTrip(req)
+	if attempts != 1 {
+		t.Errorf("got %d attempts after the context was cancelled, want 1", attempts)
+	}
+}
@@ -0,0 +1,152 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Stdin is the source that reads a single markdown document from standard input
+const Stdin = "-"
+
+// DefaultExtensions are the file extensions of the markdown files published
+// from source directories
+var DefaultExtensions = []string{".md", ".markdown", ".mdown", ".mdx"}
+
+// mdxExtension marks MDX documents, whose JSX is stripped before rendering
+const mdxExtension = ".mdx"
+
+// stdinSource holds the document read from standard input, which can only be
+// read once
+type stdinSource struct {
+	sync.Once
+	dat []byte
+	err error
+}
+
+// read returns the document, reading standard input on the first call.
+// Without a source, standard input is read every time.
+func (s *stdinSource) read() ([]byte, error) {
+	if s == nil {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	s.Do(func() {
+		s.dat, s.err = ioutil.ReadAll(os.Stdin)
+	})
+	return s.dat, s.err
+}
+
+// readMarkdown returns the source of the markdown file at p, reading
+// standard input for Stdin and stripping the JSX of MDX documents
+func (m *Markdown2Confluence) readMarkdown(p string) ([]byte, error) {
+	var (
+		dat []byte
+		err error
+	)
+	if p == Stdin {
+		dat, err = m.stdin.read()
+	} else {
+		dat, err = ioutil.ReadFile(p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(p), mdxExtension) {
+		dat = stripJSX(dat)
+	}
+	return dat, nil
+}
+
+// isMarkdown reports whether p has one of the configured markdown extensions
+func (m *Markdown2Confluence) isMarkdown(p string) bool {
+	extensions := m.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+	ext := filepath.Ext(p)
+	for _, extension := range extensions {
+		if strings.EqualFold(ext, "."+strings.TrimPrefix(extension, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// baseName returns the file name of p without extension
+func baseName(p string) string {
+	name := filepath.Base(p)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+var (
+	fenceLine = regexp.MustCompile("^\\s*(```|~~~)")
+	// esmImport matches the first line of import statements: side effect
+	// imports, imports from a module and named imports continued on the next lines
+	esmImport = regexp.MustCompile(`^import\s+(?:['"]|[\w$*{][\w$*{},\s]*\bfrom\s*['"]|(?:[\w$]+\s*,\s*)?\{[^}]*$)`)
+	// esmExport matches the first line of export declarations and re-exports
+	esmExport = regexp.MustCompile(`^export\s+(?:(?:const|let|var|default|function|async|class)\b|\{|\*)`)
+	// jsxTag matches the opening, closing and self closing tags of components,
+	// with attribute values in braces nested one level deep
+	jsxTag = regexp.MustCompile(`</?[A-Z][\w.]*(?:\s(?:[^<>{}]|\{(?:[^{}]|\{[^{}]*\})*\})*)?/?>`)
+	// jsxExpression matches braced expressions and comments on their own line
+	jsxExpression = regexp.MustCompile(`(?m)^[ \t]*\{(?:[^{}]|\{[^{}]*\})*\}[ \t]*$`)
+)
+
+// stripJSX removes the import and export statements, the component tags and
+// the expressions of an MDX document and keeps the markdown between them.
+// Removed lines are kept empty so that line numbers do not change.
+func stripJSX(source []byte) []byte {
+	lines := strings.SplitAfter(string(source), "\n")
+
+	var (
+		out   strings.Builder
+		prose strings.Builder
+		fence string
+		esm   bool
+	)
+	flush := func() {
+		text := jsxExpression.ReplaceAllStringFunc(prose.String(), keepNewlines)
+		out.WriteString(jsxTag.ReplaceAllStringFunc(text, keepNewlines))
+		prose.Reset()
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			out.WriteString(line)
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		case fenceLine.MatchString(line):
+			flush()
+			fence = fenceLine.FindStringSubmatch(line)[1]
+			out.WriteString(line)
+			continue
+		}
+
+		// import and export statements last until the next empty line
+		if esmImport.MatchString(line) || esmExport.MatchString(line) {
+			esm = true
+		}
+		if esm {
+			if trimmed == "" {
+				esm = false
+			}
+			prose.WriteString(keepNewlines(line))
+			continue
+		}
+		prose.WriteString(line)
+	}
+	flush()
+	return []byte(out.String())
+}
+
+// keepNewlines replaces s with its line breaks
+func keepNewlines(s string) string {
+	return strings.Repeat("\n", strings.Count(s, "\n"))
+}
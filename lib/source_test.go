@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStripJSX(t *testing.T) {
+	tests := []struct {
+		name string
+		mdx  string
+		want string
+	}{
+		{"plain markdown", "# Title\n\nText with <b>html</b>.\n", "# Title\n\nText with <b>html</b>.\n"},
+		{"imports", "import Tabs from '@theme/Tabs'\nimport {Tab} from './tab'\n\n# Title\n", "\n\n\n# Title\n"},
+		{
+			"multi line export",
+			"export const meta = {\n  title: 'Guide',\n}\n\nText\n",
+			"\n\n\n\nText\n",
+		},
+		{"import inside text", "We import data.\n", "We import data.\n"},
+		{
+			"more import statements",
+			"import './styles.css'\nimport * as api from \"./api\"\nimport Tabs, {\n  Tab,\n} from '@theme/Tabs'\n\nText\n",
+			"\n\n\n\n\n\nText\n",
+		},
+		{"re-export", "export {default} from './other'\nexport * from './more'\n\nText\n", "\n\n\nText\n"},
+		{"paragraph starting with import", "import data from the API.\nIt is cached.\n", "import data from the API.\nIt is cached.\n"},
+		{"paragraph starting with export", "export the pages as PDF\nfrom the space settings.\n", "export the pages as PDF\nfrom the space settings.\n"},
+		{"self closing tag", "Before <Badge text=\"new\" /> after\n", "Before  after\n"},
+		{
+			"component around markdown",
+			"<Tabs>\n<Tab label={`a ${b}`} value={{x: 1}}>\n\n**bold**\n\n</Tab>\n</Tabs>\n",
+			"\n\n\n**bold**\n\n\n\n",
+		},
+		{"multi line tag", "<Note\n  type=\"info\"\n>\nText\n</Note>\n", "\n\n\nText\n\n"},
+		{"member tags", "<Foo.Bar>x</Foo.Bar>\n", "x\n"},
+		{"expressions", "{/* a comment */}\nText {inline}\n  {props.value}\n", "\nText {inline}\n\n"},
+		{
+			"fenced code is kept",
+			"```jsx\nimport React from 'react'\n<App />\n{value}\n```\n<App />\n",
+			"```jsx\nimport React from 'react'\n<App />\n{value}\n```\n\n",
+		},
+		{"tilde fence", "~~~\n<Keep />\n~~~\n", "~~~\n<Keep />\n~~~\n"},
+	}
+	for _, test := range tests {
+		got := string(stripJSX([]byte(test.mdx)))
+		if got != test.want {
+			t.Errorf("%s: stripJSX = %q, want %q", test.name, got, test.want)
+		}
+		if strings.Count(got, "\n") != strings.Count(test.mdx, "\n") {
+			t.Errorf("%s: stripJSX changed the number of lines", test.name)
+		}
+	}
+}
+
+func TestReadStdin(t *testing.T) {
+	defer func(stdin *os.File) { os.Stdin = stdin }(os.Stdin)
+
+	// every run reads standard input once, but does not share it with other runs
+	for _, document := range []string{"# First\n", "# Second\n"} {
+		p := filepath.Join(t.TempDir(), "stdin.md")
+		if err := os.WriteFile(p, []byte(document), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		os.Stdin = f
+
+		m := &Markdown2Confluence{stdin: &stdinSource{}}
+		for i := 0; i < 2; i++ {
+			dat, err := m.readMarkdown(Stdin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(dat) != document {
+				t.Errorf("read %d of standard input = %q, want %q", i+1, dat, document)
+			}
+		}
+	}
+}
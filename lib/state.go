@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Conflict policies applied when a page was edited in Confluence since it was
+// last published
+const (
+	// ConflictFail refuses to overwrite the page
+	ConflictFail = "fail"
+	// ConflictWarn prints the remote change and overwrites the page
+	ConflictWarn = "warn"
+	// ConflictOverwrite silently overwrites the page
+	ConflictOverwrite = "overwrite"
+)
+
+// PublishedPage records what was last published to a page
+type PublishedPage struct {
+	Title   string `json:"title"`
+	Version int    `json:"version"`
+	Body    string `json:"body"`
+}
+
+// State records the pages published by previous runs, keyed by page ID
+type State struct {
+	sync.Mutex
+	Pages map[string]PublishedPage `json:"pages"`
+}
+
+// LoadState reads the state file at p. A missing file results in an empty state.
+func LoadState(p string) (*State, error) {
+	s := &State{Pages: make(map[string]PublishedPage)}
+
+	dat, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not open state file %s:\n\t%s", p, err)
+	}
+
+	if err := json.Unmarshal(dat, s); err != nil {
+		return nil, fmt.Errorf("Could not parse state file %s:\n\t%s", p, err)
+	}
+	if s.Pages == nil {
+		s.Pages = make(map[string]PublishedPage)
+	}
+	return s, nil
+}
+
+// Save writes the state to p
+func (s *State) Save(p string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	dat, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, dat, 0644)
+}
+
+// Get returns what was last published to the page with the given ID
+func (s *State) Get(id string) (PublishedPage, bool) {
+	s.Lock()
+	defer s.Unlock()
+	page, ok := s.Pages[id]
+	return page, ok
+}
+
+// Empty reports whether the state records no pages
+func (s *State) Empty() bool {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.Pages) == 0
+}
+
+// Record stores what was published to the page with the given ID
+func (s *State) Record(id string, page PublishedPage) {
+	s.Lock()
+	defer s.Unlock()
+	s.Pages[id] = page
+}
@@ -0,0 +1,540 @@
+package lib
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/justmiles/go-markdown2confluence/lib/renderer"
+)
+
+// storageNode is an element or text of a page in Confluence storage format.
+// Element names keep their namespace prefix, e.g. "ac:structured-macro".
+type storageNode struct {
+	name     string
+	attrs    map[string]string
+	text     string
+	children []*storageNode
+}
+
+// parseStorage parses Confluence storage format into a tree of nodes
+func parseStorage(s string) (*storageNode, error) {
+	d := xml.NewDecoder(strings.NewReader("<root>" + s + "</root>"))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+
+	root := &storageNode{name: "root"}
+	stack := []*storageNode{root}
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return root, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &storageNode{name: qualifiedName(t.Name), attrs: make(map[string]string)}
+			for _, attr := range t.Attr {
+				n.attrs[qualifiedName(attr.Name)] = attr.Value
+			}
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.children = append(parent.children, &storageNode{text: string(t)})
+		}
+	}
+}
+
+func qualifiedName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+// child returns the first child element with the given name
+func (n *storageNode) child(name string) *storageNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// textContent returns the concatenated text of the node and its descendants
+func (n *storageNode) textContent() string {
+	if n.name == "" {
+		return n.text
+	}
+	var b strings.Builder
+	for _, c := range n.children {
+		b.WriteString(c.textContent())
+	}
+	return b.String()
+}
+
+// macroParameters returns the ac:parameter children of a macro in order
+func (n *storageNode) macroParameters() (names, values []string) {
+	for _, c := range n.children {
+		if c.name == "ac:parameter" {
+			names = append(names, c.attrs["ac:name"])
+			values = append(values, strings.TrimSpace(c.textContent()))
+		}
+	}
+	return names, values
+}
+
+func (n *storageNode) macroParameter(name string) string {
+	names, values := n.macroParameters()
+	for i := range names {
+		if names[i] == name {
+			return values[i]
+		}
+	}
+	return ""
+}
+
+// panelMacros are rendered as block quotes with a bold label
+var panelMacros = map[string]string{
+	"info":    "Info",
+	"note":    "Note",
+	"tip":     "Tip",
+	"warning": "Warning",
+	"panel":   "",
+}
+
+// storageConverter converts Confluence storage format into markdown
+type storageConverter struct {
+	// pageLink returns the link to the page with the given title, or an empty
+	// string if the page is not part of the export
+	pageLink func(title string) string
+	// attachmentLink returns the link to an attachment of the current page
+	attachmentLink func(filename string) string
+}
+
+// storageToMarkdown converts a page body in storage format into markdown
+func (c *storageConverter) storageToMarkdown(s string) (string, error) {
+	root, err := parseStorage(s)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	c.blocks(&b, root.children)
+	return strings.TrimSpace(blankLines.ReplaceAllString(b.String(), "\n\n")) + "\n", nil
+}
+
+func (c *storageConverter) blocks(b *strings.Builder, nodes []*storageNode) {
+	var inline []*storageNode
+	flush := func() {
+		if text := strings.TrimSpace(c.inlines(inline)); text != "" {
+			b.WriteString(escapeLineStarts(text) + "\n\n")
+		}
+		inline = nil
+	}
+
+	for _, n := range nodes {
+		if isInline(n) {
+			inline = append(inline, n)
+			continue
+		}
+		flush()
+		c.block(b, n)
+	}
+	flush()
+}
+
+func (c *storageConverter) block(b *strings.Builder, n *storageNode) {
+	switch n.name {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(n.name[1] - '0')
+		b.WriteString(strings.Repeat("#", level) + " " + strings.TrimSpace(c.inlines(n.children)) + "\n\n")
+	case "p":
+		c.blocks(b, n.children)
+	case "ul", "ol":
+		c.list(b, n, 0)
+		b.WriteString("\n")
+	case "ac:task-list":
+		c.taskList(b, n, 0)
+		b.WriteString("\n")
+	case "pre":
+		b.WriteString("```\n" + strings.TrimRight(n.textContent(), "\n") + "\n```\n\n")
+	case "blockquote":
+		b.WriteString(quote(c.nested(n.children)) + "\n")
+	case "hr":
+		b.WriteString("---\n\n")
+	case "table":
+		c.table(b, n)
+	case "ac:structured-macro":
+		c.macro(b, n)
+	default:
+		c.blocks(b, n.children)
+	}
+}
+
+// nested renders block nodes into a separate string
+func (c *storageConverter) nested(nodes []*storageNode) string {
+	var b strings.Builder
+	c.blocks(&b, nodes)
+	return strings.TrimSpace(b.String())
+}
+
+func (c *storageConverter) macro(b *strings.Builder, n *storageNode) {
+	name := n.attrs["ac:name"]
+
+	if name == "code" || name == "noformat" {
+		body := ""
+		if plain := n.child("ac:plain-text-body"); plain != nil {
+			// published code blocks are padded with a space inside the CDATA section
+			body = strings.TrimSuffix(strings.TrimPrefix(plain.textContent(), " "), " ")
+			body = strings.Trim(body, "\n")
+		}
+		b.WriteString("```" + n.macroParameter("language") + "\n" + body + "\n```\n\n")
+		return
+	}
+
+	if label, ok := panelMacros[name]; ok {
+		if title := n.macroParameter("title"); title != "" {
+			label = title
+		}
+		content := ""
+		if rich := n.child("ac:rich-text-body"); rich != nil {
+			content = c.nested(rich.children)
+		}
+		if label != "" {
+			content = "**" + label + "**\n\n" + content
+		}
+		b.WriteString(quote(content) + "\n")
+		return
+	}
+
+	// any other macro round trips through a CONFLUENCE-MACRO block
+	b.WriteString("```" + renderer.LanguageStringConfluenceMacro + "\n")
+	b.WriteString("name:" + name + "\n")
+	if version := n.attrs["ac:schema-version"]; version != "" {
+		b.WriteString("schema-version:" + version + "\n")
+	}
+	names, values := n.macroParameters()
+	for i := range names {
+		b.WriteString("  " + names[i] + ":" + values[i] + "\n")
+	}
+	b.WriteString("```\n\n")
+
+	if rich := n.child("ac:rich-text-body"); rich != nil {
+		c.blocks(b, rich.children)
+	}
+}
+
+func (c *storageConverter) list(b *strings.Builder, n *storageNode, depth int) {
+	number := 1
+	for _, item := range n.children {
+		if item.name != "li" {
+			continue
+		}
+		marker := "- "
+		if n.name == "ol" {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		c.listItem(b, item.children, strings.Repeat("  ", depth)+marker, depth)
+	}
+}
+
+func (c *storageConverter) taskList(b *strings.Builder, n *storageNode, depth int) {
+	for _, task := range n.children {
+		if task.name != "ac:task" {
+			continue
+		}
+		marker := "- [ ] "
+		if status := task.child("ac:task-status"); status != nil && strings.TrimSpace(status.textContent()) == "complete" {
+			marker = "- [x] "
+		}
+		var body []*storageNode
+		if taskBody := task.child("ac:task-body"); taskBody != nil {
+			body = taskBody.children
+		}
+		c.listItem(b, body, strings.Repeat("  ", depth)+marker, depth)
+	}
+}
+
+// listItem writes the text of an item on the marker line, followed by any nested lists
+func (c *storageConverter) listItem(b *strings.Builder, nodes []*storageNode, marker string, depth int) {
+	var text []string
+	var nested []*storageNode
+	for _, n := range nodes {
+		switch n.name {
+		case "ul", "ol", "ac:task-list":
+			nested = append(nested, n)
+		case "p":
+			text = append(text, strings.TrimSpace(c.inlines(n.children)))
+		default:
+			text = append(text, strings.TrimSpace(c.inlines([]*storageNode{n})))
+		}
+	}
+	b.WriteString(marker + escapeLineStarts(strings.TrimSpace(strings.Join(text, " "))) + "\n")
+
+	for _, n := range nested {
+		if n.name == "ac:task-list" {
+			c.taskList(b, n, depth+1)
+		} else {
+			c.list(b, n, depth+1)
+		}
+	}
+}
+
+func (c *storageConverter) table(b *strings.Builder, n *storageNode) {
+	var rows [][]string
+	var collect func(nodes []*storageNode)
+	collect = func(nodes []*storageNode) {
+		for _, child := range nodes {
+			switch child.name {
+			case "tr":
+				var row []string
+				for _, cell := range child.children {
+					if cell.name == "th" || cell.name == "td" {
+						text := strings.ReplaceAll(c.cell(cell), "|", `\|`)
+						row = append(row, text)
+					}
+				}
+				rows = append(rows, row)
+			case "thead", "tbody", "tfoot":
+				collect(child.children)
+			}
+		}
+	}
+	collect(n.children)
+	if len(rows) == 0 {
+		return
+	}
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		}
+	}
+	b.WriteString("\n")
+}
+
+// cell renders a table cell on a single line
+func (c *storageConverter) cell(n *storageNode) string {
+	var parts []string
+	for _, child := range n.children {
+		if child.name == "p" {
+			parts = append(parts, strings.TrimSpace(c.inlines(child.children)))
+		} else if text := strings.TrimSpace(c.inlines([]*storageNode{child})); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.ReplaceAll(strings.Join(parts, "<br />"), "\n", " ")
+}
+
+func (c *storageConverter) inlines(nodes []*storageNode) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		b.WriteString(c.inline(n))
+	}
+	return b.String()
+}
+
+func (c *storageConverter) inline(n *storageNode) string {
+	switch n.name {
+	case "":
+		return escapeText(whitespace.ReplaceAllString(strings.ReplaceAll(n.text, "\u00a0", " "), " "))
+	case "strong", "b":
+		return wrap("**", c.inlines(n.children))
+	case "em", "i":
+		return wrap("_", c.inlines(n.children))
+	case "s", "del":
+		return wrap("~~", c.inlines(n.children))
+	case "code":
+		return "`" + n.textContent() + "`"
+	case "br":
+		return "  \n"
+	case "a":
+		return "[" + strings.TrimSpace(c.inlines(n.children)) + "](" + n.attrs["href"] + ")"
+	case "img":
+		return "![" + escapeText(n.attrs["alt"]) + "](" + n.attrs["src"] + ")"
+	case "ac:image":
+		if attachment := n.child("ri:attachment"); attachment != nil {
+			return "![](" + c.attachmentLink(attachment.attrs["ri:filename"]) + ")"
+		}
+		if u := n.child("ri:url"); u != nil {
+			return "![](" + u.attrs["ri:value"] + ")"
+		}
+		return ""
+	case "ac:link":
+		return c.link(n)
+	case "ac:structured-macro":
+		// inline macros such as status are reduced to their title
+		if title := n.macroParameter("title"); title != "" {
+			return "`" + title + "`"
+		}
+		return ""
+	case "ac:emoticon", "ac:placeholder", "ac:parameter":
+		return ""
+	default:
+		return c.inlines(n.children)
+	}
+}
+
+func (c *storageConverter) link(n *storageNode) string {
+	text := ""
+	if body := n.child("ac:plain-text-link-body"); body != nil {
+		text = escapeText(body.textContent())
+	} else if body := n.child("ac:link-body"); body != nil {
+		text = strings.TrimSpace(c.inlines(body.children))
+	}
+
+	target := ""
+	if page := n.child("ri:page"); page != nil {
+		title := page.attrs["ri:content-title"]
+		if text == "" {
+			text = escapeText(title)
+		}
+		target = c.pageLink(title)
+		if target == "" {
+			// the page is not part of the export, keep its title
+			return text
+		}
+	} else if attachment := n.child("ri:attachment"); attachment != nil {
+		filename := attachment.attrs["ri:filename"]
+		if text == "" {
+			text = escapeText(filename)
+		}
+		target = c.attachmentLink(filename)
+	}
+
+	if anchor := n.attrs["ac:anchor"]; anchor != "" {
+		target += "#" + anchor
+	}
+	if target == "" {
+		return text
+	}
+	return "[" + text + "](" + target + ")"
+}
+
+// isInline reports whether n is rendered as part of a paragraph
+func isInline(n *storageNode) bool {
+	switch n.name {
+	case "", "strong", "b", "em", "i", "s", "del", "u", "code", "br", "a", "img", "span", "sub", "sup",
+		"ac:image", "ac:link", "ac:emoticon", "ac:placeholder", "ac:inline-comment-marker", "time":
+		return true
+	case "ac:structured-macro":
+		return n.attrs["ac:name"] == "status" || n.attrs["ac:name"] == "anchor"
+	}
+	return false
+}
+
+var (
+	whitespace = regexp.MustCompile(`\s+`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+	// blockMarker matches text at the start of a line that markdown reads as a
+	// heading, list item, block quote, thematic break or setext underline
+	blockMarker = regexp.MustCompile(`^(#{1,6}|\d{1,9}[.)]|[-+=]+)(\s|$)|^>`)
+)
+
+// escapeText escapes the characters of a text node that markdown would read
+// as inline syntax. Underscores within words do not emphasize and are kept.
+func escapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\', '`', '*', '[', ']', '<', '~':
+			b.WriteByte('\\')
+		case '_':
+			if i == 0 || i == len(s)-1 || !isWordByte(s[i-1]) || !isWordByte(s[i+1]) {
+				b.WriteByte('\\')
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// escapeLineStarts escapes block markers at the start of the lines of a
+// paragraph, e.g. a leading "1." that would start an ordered list
+func escapeLineStarts(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if loc := blockMarker.FindStringIndex(line); loc != nil {
+			// numbered list markers are escaped at their delimiter
+			at := 0
+			for at < len(line) && line[at] >= '0' && line[at] <= '9' {
+				at++
+			}
+			lines[i] = line[:at] + "\\" + line[at:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrap surrounds text with a markdown delimiter, keeping surrounding spaces outside
+func wrap(delimiter, text string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	leading := text[:strings.Index(text, trimmed)]
+	trailing := text[len(leading)+len(trimmed):]
+	return leading + delimiter + trimmed + delimiter + trailing
+}
+
+// quote prefixes every line of s for a markdown block quote
+func quote(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = ">"
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// relativeLink returns a markdown link from the file at from to the file at to
+func relativeLink(from, to string) string {
+	fromDir := path.Dir(from)
+	fromParts := strings.Split(fromDir, "/")
+	toParts := strings.Split(to, "/")
+	if fromDir == "." {
+		fromParts = nil
+	}
+
+	common := 0
+	for common < len(fromParts) && common < len(toParts)-1 && fromParts[common] == toParts[common] {
+		common++
+	}
+	parts := make([]string, 0, len(fromParts)-common+len(toParts)-common)
+	for range fromParts[common:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, toParts[common:]...)
+	return strings.ReplaceAll(strings.Join(parts, "/"), " ", "%20")
+}
@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestStorageToMarkdown(t *testing.T) {
+	converter := &storageConverter{
+		pageLink: func(title string) string {
+			if title == "Install" {
+				return "install.md"
+			}
+			return ""
+		},
+		attachmentLink: func(filename string) string {
+			return "attachments/" + filename
+		},
+	}
+
+	tests := []struct {
+		name    string
+		storage string
+		want    string
+	}{
+		{"paragraphs", "<p>one</p><p>two</p>", "one\n\ntwo\n"},
+		{"headings", "<h1>Title</h1><h3>Sub</h3>", "# Title\n\n### Sub\n"},
+		{"emphasis", "<p><strong>bold</strong> and <em>it</em> and <del>gone</del></p>", "**bold** and _it_ and ~~gone~~\n"},
+		{"inline code is not escaped", "<p><code>a*b_c</code></p>", "`a*b_c`\n"},
+		{"escaped emphasis", "<p>2 * 3 * 4 and _init_</p>", "2 \\* 3 \\* 4 and \\_init\\_\n"},
+		{"intraword underscores", "<p>snake_case_name</p>", "snake_case_name\n"},
+		{"escaped brackets", "<p>[not a link](x)</p>", "\\[not a link\\](x)\n"},
+		{"escaped html", "<p>&lt;div&gt;</p>", "\\<div>\n"},
+		{"escaped heading", "<p># not a heading</p>", "\\# not a heading\n"},
+		{"escaped ordered list", "<p>1. not a list</p>", "1\\. not a list\n"},
+		{"escaped bullet", "<p>- not a list</p>", "\\- not a list\n"},
+		{"escaped quote", "<p>&gt; not a quote</p>", "\\> not a quote\n"},
+		{"escaped line after break", "<p>a<br/># b</p>", "a  \n\\# b\n"},
+		{"hash inside text", "<p>C# and #1</p>", "C# and #1\n"},
+		{"number inside text", "<p>version 1. or 2</p>", "version 1. or 2\n"},
+		{"lists", "<ul><li>a<ol><li>b</li><li>c</li></ol></li></ul>", "- a\n  1. b\n  2. c\n"},
+		{"escaped list item", "<ul><li>1. first</li></ul>", "- 1\\. first\n"},
+		{"task list", `<ac:task-list><ac:task><ac:task-status>complete</ac:task-status><ac:task-body>done</ac:task-body></ac:task><ac:task><ac:task-status>incomplete</ac:task-status><ac:task-body>todo</ac:task-body></ac:task></ac:task-list>`, "- [x] done\n- [ ] todo\n"},
+		{"code macro", `<ac:structured-macro ac:name="code"><ac:parameter ac:name="language">go</ac:parameter><ac:plain-text-body><![CDATA[ a := *b ]]></ac:plain-text-body></ac:structured-macro>`, "```go\na := *b\n```\n"},
+		{"panel macro", `<ac:structured-macro ac:name="info"><ac:rich-text-body><p>Read *this*</p></ac:rich-text-body></ac:structured-macro>`, "> **Info**\n>\n> Read \\*this\\*\n"},
+		{"other macro", `<ac:structured-macro ac:name="toc" ac:schema-version="1"><ac:parameter ac:name="maxLevel">2</ac:parameter></ac:structured-macro>`, "```CONFLUENCE-MACRO\nname:toc\nschema-version:1\n  maxLevel:2\n```\n"},
+		{"table", "<table><tbody><tr><th>a</th><th>b</th></tr><tr><td>1|2</td><td>x*y</td></tr></tbody></table>", "| a | b |\n| --- | --- |\n| 1\\|2 | x\\*y |\n"},
+		{"link", `<p><a href="https://example.com">the_site</a></p>`, "[the_site](https://example.com)\n"},
+		{"page link", `<p><ac:link><ri:page ri:content-title="Install" /></ac:link></p>`, "[Install](install.md)\n"},
+		{"page outside the export", `<p><ac:link><ri:page ri:content-title="Other [draft]" /></ac:link></p>`, "Other \\[draft\\]\n"},
+		{"attachment image", `<p><ac:image><ri:attachment ri:filename="diagram.png" /></ac:image></p>`, "![](attachments/diagram.png)\n"},
+		{"thematic break", "<p>a</p><hr/><p>b</p>", "a\n\n---\n\nb\n"},
+		{"collapsed blank lines", "<p>a</p><p></p><p></p><p>b</p>", "a\n\nb\n"},
+	}
+	for _, test := range tests {
+		got, err := converter.storageToMarkdown(test.storage)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: storageToMarkdown = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRelativeLink(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     string
+	}{
+		{"a.md", "b.md", "b.md"},
+		{"guide/a.md", "guide/b.md", "b.md"},
+		{"guide/a.md", "b.md", "../b.md"},
+		{"a.md", "guide/b c.md", "guide/b%20c.md"},
+		{"x/y/a.md", "x/z/b.md", "../z/b.md"},
+	}
+	for _, test := range tests {
+		if got := relativeLink(test.from, test.to); got != test.want {
+			t.Errorf("relativeLink(%q, %q) = %q, want %q", test.from, test.to, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/justmiles/go-confluence"
+)
+
+const (
+	// TitleStrategyFail refuses to publish pages whose titles collide
+	TitleStrategyFail = "fail"
+	// TitleStrategyParent prefixes colliding titles with the title of their parent
+	TitleStrategyParent = "parent"
+	// TitleStrategyPath prefixes colliding titles with the titles of all their parents
+	TitleStrategyPath = "path"
+
+	// titleSeparator joins the parts of disambiguated titles
+	titleSeparator = " - "
+)
+
+// runPage is a page published by a run, either from a markdown file or as folder page
+type runPage struct {
+	space string
+	path  []string
+	title string
+	owner string
+}
+
+// disambiguateTitles finds pages of the run that share a title within a
+// space and renames them according to the title strategy. With the fail
+// strategy it returns an error listing the collisions.
+func (m *Markdown2Confluence) disambiguateTitles(markdownFiles []MarkdownFile) ([]MarkdownFile, error) {
+	pages := make(map[string]*runPage)
+	titles := make(map[string][]string)
+	add := func(space string, path []string, title, owner string) {
+		key := parentIndexKey(space, path, title)
+		if _, ok := pages[key]; ok {
+			return
+		}
+		pages[key] = &runPage{space: space, path: path, title: title, owner: owner}
+		titleKey := space + ":" + title
+		titles[titleKey] = append(titles[titleKey], key)
+	}
+
+	for _, markdownFile := range markdownFiles {
+		space := markdownFile.pageSettings(m).Space
+		var path []string
+		for _, parent := range deleteEmpty(markdownFile.Parents) {
+			owner := "folder " + strings.Join(append(append([]string{}, path...), parent), "/")
+			if indexPath, ok := m.folderIndexes[parentIndexKey(space, path, parent)]; ok {
+				owner = indexPath
+			}
+			add(space, append([]string{}, path...), parent, owner)
+			path = append(path, parent)
+		}
+		add(space, path, markdownFile.Title, markdownFile.Path)
+	}
+
+	// rename the colliding pages
+	renamed := make(map[string]string)
+	var collisions []string
+	for _, keys := range titles {
+		if len(keys) < 2 {
+			continue
+		}
+		if m.TitleStrategy == "" || m.TitleStrategy == TitleStrategyFail {
+			var owners []string
+			for _, key := range keys {
+				owners = append(owners, pages[key].owner)
+			}
+			page := pages[keys[0]]
+			collisions = append(collisions, fmt.Sprintf("page title %q in space %s is used by %s", page.title, page.space, strings.Join(owners, ", ")))
+			continue
+		}
+		for _, key := range keys {
+			page := pages[key]
+			renamed[key] = strategyTitle(m.TitleStrategy, page.path, page.title)
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return nil, fmt.Errorf("Page titles must be unique within a space, use --title-strategy to disambiguate them:\n\t%s", strings.Join(collisions, "\n\t"))
+	}
+	if len(renamed) == 0 {
+		return markdownFiles, nil
+	}
+
+	// the new titles must be unique as well
+	used := make(map[string]string)
+	for key, page := range pages {
+		title := page.title
+		if t, ok := renamed[key]; ok {
+			title = t
+		}
+		if other, ok := used[page.space+":"+title]; ok {
+			return nil, fmt.Errorf("Unable to disambiguate page title %q in space %s used by %s and %s", title, page.space, pages[other].owner, page.owner)
+		}
+		used[page.space+":"+title] = key
+	}
+
+	// apply the new titles to the files, their parents and the folder index files
+	folderIndexes := make(map[string]string)
+	for key, p := range m.folderIndexes {
+		folderIndexes[key] = p
+	}
+	for i, markdownFile := range markdownFiles {
+		space := markdownFile.pageSettings(m).Space
+		var path, parents []string
+		changed := false
+		for _, parent := range deleteEmpty(markdownFile.Parents) {
+			title := parent
+			if t, ok := renamed[parentIndexKey(space, path, parent)]; ok {
+				title, changed = t, true
+			}
+			path = append(path, parent)
+			parents = append(parents, title)
+		}
+		key := parentIndexKey(space, path, markdownFile.Title)
+		title, ok := renamed[key]
+		if !ok && !changed {
+			continue
+		}
+		if !ok {
+			title = markdownFile.Title
+		}
+		if ok {
+			m.debugf("Publishing %s as %q to disambiguate its title\n", markdownFile.Path, title)
+		}
+
+		if m.folderIndexes[key] == markdownFile.Path {
+			delete(folderIndexes, key)
+			folderIndexes[parentIndexKey(space, parents, title)] = markdownFile.Path
+		}
+		markdownFiles[i].Parents = parents
+		markdownFiles[i].Title = title
+	}
+	m.folderIndexes = folderIndexes
+	return markdownFiles, nil
+}
+
+// strategyTitle prefixes a title with its parent or its path. Pages at the
+// top keep their title.
+func strategyTitle(strategy string, path []string, title string) string {
+	if len(path) == 0 {
+		return title
+	}
+	if strategy == TitleStrategyParent {
+		return path[len(path)-1] + titleSeparator + title
+	}
+	return strings.Join(append(append([]string{}, path...), title), titleSeparator)
+}
+
+// treeRoot returns the id of the topmost parent page of the file, or an empty
+// string if the file is published at the top of the space
+func (f *MarkdownFile) treeRoot(m *Markdown2Confluence) string {
+	if f.root != "" {
+		return f.root
+	}
+	if parents := deleteEmpty(f.Parents); len(parents) > 0 {
+		return m.parents.ID(parentIndexKey(f.pageSettings(m).Space, nil, parents[0]))
+	}
+	return f.Ancestor
+}
+
+// outsideTree reports whether an existing page is outside of the tree below
+// root, in which case it is not managed by this run. Without root the pages
+// are published at the top of the space, so pages with ancestors are outside.
+func outsideTree(content confluence.Content, root string) bool {
+	if root == "" {
+		return len(content.Ancestors) > 0
+	}
+	if content.ID == root {
+		return false
+	}
+	for _, ancestor := range content.Ancestors {
+		if ancestor.ID == root {
+			return false
+		}
+	}
+	return true
+}
+
+// titleCollision returns the error for a page outside of the published tree
+// that has the title of a page to publish
+func titleCollision(title string, content confluence.Content) error {
+	return fmt.Errorf("page %s (id %s) already exists outside of the published pages, use --title-strategy to disambiguate the title", title, content.ID)
+}
+
+// TitleData is passed to the --title-template of every markdown file
+type TitleData struct {
+	// Name is the file name without extension
+	Name string
+	// Path is the path of the markdown file
+	Path string
+	// Parents are the titles of the parent pages
+	Parents []string
+	// FrontMatter holds the YAML front matter of the file
+	FrontMatter map[string]interface{}
+	// Heading is the first heading of the document
+	Heading string
+	// Title is the title that is used without a template
+	Title string
+}
+
+var (
+	// numericPrefix matches ordering prefixes such as 01- or 2_
+	numericPrefix  = regexp.MustCompile(`^(\d+)[._\s-]+`)
+	wordSeparators = regexp.MustCompile(`[-_\s]+`)
+	headingLine    = regexp.MustCompile(`(?m)^#{1,6}\s+(.+?)\s*#*\s*$`)
+)
+
+// splitNumericPrefix separates the numeric ordering prefix from a file or
+// folder name without extension. Names that are only a number have none.
+func splitNumericPrefix(name string) (weight float64, rest string, ok bool) {
+	match := numericPrefix.FindStringSubmatch(name)
+	if match == nil || len(match[0]) == len(name) {
+		return 0, name, false
+	}
+	weight, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, name, false
+	}
+	return weight, name[len(match[0]):], true
+}
+
+// humanizeTitle strips the numeric ordering prefix from a file or folder name
+// and converts kebab and snake case to title case
+func humanizeTitle(name string) string {
+	_, name, _ = splitNumericPrefix(name)
+	words := deleteEmpty(wordSeparators.Split(name, -1))
+	for i, word := range words {
+		r, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToTitle(r)) + word[size:]
+	}
+	return strings.Join(words, " ")
+}
+
+// folderTitle returns the title of the folder page for a directory name
+func (m *Markdown2Confluence) folderTitle(name string) string {
+	if m.HumanizeTitles {
+		name = humanizeTitle(name)
+	}
+	return m.TitlePrefix + name + m.TitleSuffix
+}
+
+// folderTitles returns the titles of the folder pages for directory names
+func (m *Markdown2Confluence) folderTitles(names []string) []string {
+	titles := make([]string, len(names))
+	for i, name := range names {
+		if name != "" {
+			titles[i] = m.folderTitle(name)
+		}
+	}
+	return titles
+}
+
+// pageTitle returns the title of the markdown file at p named name, applying
+// the title template, humanization and the global prefix and suffix
+func (m *Markdown2Confluence) pageTitle(p, name string, parents []string, useDocumentTitle bool) (string, error) {
+	title := name
+	if m.HumanizeTitles {
+		title = humanizeTitle(name)
+	}
+	if useDocumentTitle {
+		documentTitle, err := m.getDocumentTitle(p)
+		if err != nil {
+			return "", err
+		}
+		if documentTitle != "" {
+			title = documentTitle
+		}
+	}
+
+	if m.titleTemplate != nil {
+		dat, err := m.readMarkdown(p)
+		if err != nil {
+			return "", fmt.Errorf("Could not open file %s:\n\t%s", p, err)
+		}
+		frontMatter, body := splitFrontMatter(dat)
+		if frontMatter == nil {
+			frontMatter = make(map[string]interface{})
+		}
+		data := TitleData{
+			Name:        name,
+			Path:        p,
+			Parents:     deleteEmpty(parents),
+			FrontMatter: frontMatter,
+			Title:       title,
+		}
+		if heading := headingLine.FindSubmatch(body); heading != nil {
+			data.Heading = string(heading[1])
+		}
+
+		var buf bytes.Buffer
+		if err := m.titleTemplate.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("Unable to execute --title-template for %s: %s", p, err)
+		}
+		if title = strings.TrimSpace(buf.String()); title == "" {
+			return "", fmt.Errorf("--title-template resulted in an empty title for %s", p)
+		}
+	}
+	return m.TitlePrefix + title + m.TitleSuffix, nil
+}
@@ -0,0 +1,155 @@
+package lib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHumanizeTitle(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+	}{
+		{"getting-started", "Getting Started"},
+		{"api_reference", "Api Reference"},
+		{"01-install", "Install"},
+		{"2_configure", "Configure"},
+		{"10. usage", "Usage"},
+		{"01-02-intro", "02 Intro"},
+		{"2024", "2024"},
+		{"01-", "01"},
+		{"v2-notes", "V2 Notes"},
+		{"überblick", "Überblick"},
+	}
+	for _, test := range tests {
+		if title := humanizeTitle(test.name); title != test.title {
+			t.Errorf("humanizeTitle(%q) = %q, want %q", test.name, title, test.title)
+		}
+	}
+}
+
+func TestSplitNumericPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		weight float64
+		rest   string
+		ok     bool
+	}{
+		{"01-install", 1, "install", true},
+		{"10_usage", 10, "usage", true},
+		{"3. faq", 3, "faq", true},
+		{"01-02-intro", 1, "02-intro", true},
+		{"install", 0, "install", false},
+		{"2024", 0, "2024", false},
+		{"01-", 0, "01-", false},
+	}
+	for _, test := range tests {
+		weight, rest, ok := splitNumericPrefix(test.name)
+		if weight != test.weight || rest != test.rest || ok != test.ok {
+			t.Errorf("splitNumericPrefix(%q) = %v, %q, %t, want %v, %q, %t", test.name, weight, rest, ok, test.weight, test.rest, test.ok)
+		}
+	}
+}
+
+func TestStrategyTitle(t *testing.T) {
+	tests := []struct {
+		strategy string
+		path     []string
+		title    string
+		want     string
+	}{
+		{TitleStrategyParent, nil, "Overview", "Overview"},
+		{TitleStrategyParent, []string{"Docs", "Guide"}, "Overview", "Guide - Overview"},
+		{TitleStrategyPath, []string{"Docs", "Guide"}, "Overview", "Docs - Guide - Overview"},
+		{TitleStrategyPath, nil, "Overview", "Overview"},
+	}
+	for _, test := range tests {
+		if title := strategyTitle(test.strategy, test.path, test.title); title != test.want {
+			t.Errorf("strategyTitle(%s, %v, %q) = %q, want %q", test.strategy, test.path, test.title, title, test.want)
+		}
+	}
+}
+
+func TestDisambiguateTitles(t *testing.T) {
+	type page struct {
+		parents []string
+		title   string
+	}
+	tests := []struct {
+		name     string
+		strategy string
+		files    []page
+		want     []page
+		err      string
+	}{
+		{
+			name:     "unique titles",
+			strategy: TitleStrategyFail,
+			files:    []page{{nil, "Install"}, {[]string{"guide"}, "Usage"}},
+			want:     []page{{nil, "Install"}, {[]string{"guide"}, "Usage"}},
+		},
+		{
+			name:     "file next to its folder",
+			strategy: "",
+			files:    []page{{nil, "api"}, {[]string{"api"}, "client"}},
+			want:     []page{{nil, "api"}, {[]string{"api"}, "client"}},
+		},
+		{
+			name:     "file next to its folder below a parent",
+			strategy: TitleStrategyFail,
+			files:    []page{{[]string{"Docs"}, "api"}, {[]string{"Docs", "api"}, "server"}},
+			want:     []page{{[]string{"Docs"}, "api"}, {[]string{"Docs", "api"}, "server"}},
+		},
+		{
+			name:     "folder colliding with a file elsewhere",
+			strategy: TitleStrategyFail,
+			files:    []page{{[]string{"api"}, "client"}, {[]string{"Docs"}, "api"}},
+			err:      `page title "api" in space SP is used by folder api, b.md`,
+		},
+		{
+			name:     "colliding files fail",
+			strategy: TitleStrategyFail,
+			files:    []page{{[]string{"guide"}, "Overview"}, {[]string{"reference"}, "Overview"}},
+			err:      `page title "Overview" in space SP is used by a.md, b.md`,
+		},
+		{
+			name:     "colliding files with parent strategy",
+			strategy: TitleStrategyParent,
+			files:    []page{{[]string{"guide"}, "Overview"}, {[]string{"reference"}, "Overview"}},
+			want:     []page{{[]string{"guide"}, "guide - Overview"}, {[]string{"reference"}, "reference - Overview"}},
+		},
+		{
+			name:     "colliding folders with path strategy",
+			strategy: TitleStrategyPath,
+			files:    []page{{[]string{"v1", "api"}, "a"}, {[]string{"v2", "api"}, "b"}},
+			want:     []page{{[]string{"v1", "v1 - api"}, "a"}, {[]string{"v2", "v2 - api"}, "b"}},
+		},
+	}
+	for _, test := range tests {
+		m := &Markdown2Confluence{Space: "SP", TitleStrategy: test.strategy}
+		var markdownFiles []MarkdownFile
+		for i, f := range test.files {
+			markdownFiles = append(markdownFiles, MarkdownFile{Path: string(rune('a'+i)) + ".md", Parents: f.parents, Title: f.title})
+		}
+
+		markdownFiles, err := m.disambiguateTitles(markdownFiles)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		var got []page
+		for _, f := range markdownFiles {
+			got = append(got, page{f.Parents, f.Title})
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
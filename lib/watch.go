@@ -0,0 +1,125 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// DefaultWatchInterval is how often the sources are polled for changes
+	DefaultWatchInterval = time.Second
+
+	// DefaultWatchDebounce is how long the sources have to be quiet before changes are published
+	DefaultWatchDebounce = 500 * time.Millisecond
+)
+
+// fileVersion identifies a version of a file on disk
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch polls the sources every interval and republishes the markdown files
+// that changed, or whose images or linked files changed, once no further
+// changes were seen for the debounce duration. It returns when stop is closed.
+func (m *Markdown2Confluence) Watch(interval, debounce time.Duration, stop <-chan struct{}) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+
+	_, previous, err := m.watchSnapshot()
+	if err != nil {
+		return err
+	}
+
+	var (
+		pending    = make(map[string]bool)
+		lastChange time.Time
+		ticker     = time.NewTicker(interval)
+	)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		markdownFiles, current, err := m.watchSnapshot()
+		if err != nil {
+			m.logf("%s\n", err)
+			continue
+		}
+
+		for p, version := range current {
+			if previous[p] != version {
+				pending[p] = true
+				lastChange = time.Now()
+			}
+		}
+		previous = current
+
+		if len(pending) == 0 || time.Since(lastChange) < debounce {
+			continue
+		}
+
+		var affected []MarkdownFile
+		for _, markdownFile := range markdownFiles {
+			if dependency, _ := m.changedDependency(markdownFile.Path, pending); dependency != "" {
+				affected = append(affected, markdownFile)
+			}
+		}
+		pending = make(map[string]bool)
+		if len(affected) == 0 {
+			continue
+		}
+
+		// resolve parents again so that changed folder index files are republished
+		m.parents = newParentIndex()
+		results := m.publishAll(context.Background(), affected)
+		errors := uploadErrors(results)
+		if err := m.saveState(); err != nil {
+			errors = append(errors, err)
+		}
+		if err := m.report(results, nil); err != nil {
+			errors = append(errors, err)
+		}
+		for _, err := range errors {
+			m.logf("%s\n", err)
+		}
+	}
+}
+
+// watchSnapshot discovers the markdown files of all sources and records the
+// version of every file they consist of or reference, keyed by absolute path
+func (m *Markdown2Confluence) watchSnapshot() ([]MarkdownFile, map[string]fileVersion, error) {
+	markdownFiles, err := m.discoverAll(time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snapshot := make(map[string]fileVersion)
+	for _, markdownFile := range markdownFiles {
+		references, err := m.localReferences(markdownFile.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		abs, err := filepath.Abs(markdownFile.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, p := range append(references, abs) {
+			if _, ok := snapshot[p]; ok {
+				continue
+			}
+			if info, err := os.Stat(p); err == nil && !info.IsDir() {
+				snapshot[p] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+			}
+		}
+	}
+	return markdownFiles, snapshot, nil
+}